@@ -82,6 +82,11 @@ func ParseArgs(flags []*CommandLineFlag, args *CommandLineArgs) func() {
     return pflag.Usage
 }
 
+// Number of args before "--", -1 if there was no "--"
+func ArgsLenAtDash() int {
+    return pflag.CommandLine.ArgsLenAtDash()
+}
+
 // A thin wrapper intended for main() funcs. Calls ParseArgs() and sets panic() handler
 func Run(flags []*CommandLineFlag, args *CommandLineArgs, main_fn func()) {
     usage_fn := ParseArgs(flags, args)
@@ -0,0 +1,46 @@
+// encrypt, decrypt and keygen commands
+
+package main
+
+import (
+    "fmt"
+    "io/ioutil"
+    "os"
+    "strings"
+
+    "github.com/catalyst/gotiller/sources"
+    "github.com/catalyst/gotiller/util"
+)
+
+// Var name and value from the args, value from stdin if not given
+func nameValueArgs(args []string) (string, string) {
+    if len(args) == 0 {
+        panic("Var name is required")
+    }
+    if len(args) > 1 {
+        return args[0], args[1]
+    }
+    in, err := ioutil.ReadAll(os.Stdin)
+    if err != nil {
+        panic(err)
+    }
+    return args[0], strings.TrimRight(string(in), "\r\n")
+}
+
+func encryptCommand(_ *options, args []string) {
+    name, value := nameValueArgs(args)
+    fmt.Println(util.Encrypt(sources.EncryptionKey(), name, value))
+}
+
+func decryptCommand(_ *options, args []string) {
+    name, value := nameValueArgs(args)
+    plaintext, err := util.Decrypt(sources.EncryptionKey(), name, value)
+    if err != nil {
+        panic(err)
+    }
+    fmt.Println(plaintext)
+}
+
+func keygenCommand(_ *options, _ []string) {
+    fmt.Println(util.GenerateEncryptionKey())
+}
@@ -0,0 +1,70 @@
+// exec command - process, then replace gotiller with the container main
+// process, so it gets the signals.
+// supervise command - keep processing, and signal the child on changes.
+
+package main
+
+import (
+    "os"
+    "os/exec"
+    "strings"
+    "syscall"
+
+    "github.com/catalyst/gotiller"
+    "github.com/catalyst/gotiller/command"
+    "github.com/catalyst/gotiller/util"
+)
+
+// Splits subcommand args [environment] -- command [args]
+func commandArgs(subcommand string, args []string) (string, []string) {
+    // ArgsLenAtDash counts the subcommand arg too
+    at_dash := command.ArgsLenAtDash() - 1
+    if at_dash < 0 || at_dash > 1 || at_dash == len(args) {
+        panic(subcommand + " needs -- command [args]")
+    }
+    env := ""
+    if at_dash == 1 {
+        env = args[0]
+    }
+    return env, args[at_dash:]
+}
+
+func execCommand(o *options, args []string) {
+    env, cmd_args := commandArgs("exec", args)
+
+    processor, result := gotiller.ProcessWithResult(o.Dir, env, o.TargetBaseDir, o.Verbose, o.NoHostFuncs)
+    if result.Failed() {
+        os.Exit(1)
+    }
+
+    cmd_env := os.Environ()
+    if o.Export != "" {
+        vars := processor.Vars(result.Environment)
+        cmd_env = util.MergeEnv(cmd_env, vars.ExportEnv(strings.Split(o.Export, ",")))
+    }
+
+    path, err := exec.LookPath(cmd_args[0])
+    if err != nil {
+        panic(err)
+    }
+    if err := syscall.Exec(path, cmd_args, cmd_env); err != nil {
+        panic(err)
+    }
+}
+
+func superviseCommand(o *options, args []string) {
+    env, cmd_args := commandArgs("supervise", args)
+
+    s := gotiller.Supervisor{
+        Dir:           o.Dir,
+        Environment:   env,
+        TargetBaseDir: o.TargetBaseDir,
+        Verbose:       o.Verbose,
+        NoHostFuncs:   o.NoHostFuncs,
+        Args:          cmd_args,
+    }
+    if o.Export != "" {
+        s.Export = strings.Split(o.Export, ",")
+    }
+    os.Exit(s.Run())
+}
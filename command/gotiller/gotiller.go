@@ -39,12 +39,86 @@ var command_line_flags = []*command.CommandLineFlag{
         false,
         nil,
     },
+    &command.CommandLineFlag{
+        "lint",
+        "l",
+        "report unused vars and templates, and specs without templates, for all environments",
+        "",
+        false,
+        false,
+        nil,
+    },
+    &command.CommandLineFlag{
+        "no-host-functions",
+        "",
+        "disable host dependent template functions (hostname, ipv4 etc), for reproducible output",
+        "",
+        false,
+        false,
+        nil,
+    },
+    &command.CommandLineFlag{
+        "no-exec-sources",
+        "",
+        "forbid sources that run commands (exec_vars); also " + sources.NoExecEnvVar + " env var",
+        "",
+        false,
+        false,
+        nil,
+    },
+    &command.CommandLineFlag{
+        "key-file",
+        "k",
+        fmt.Sprintf("encryption key file (default $%s, then $%s)", sources.EncryptionKeyFileEnvVar, sources.EncryptionKeyEnvVar),
+        "path",
+        false,
+        "",
+        nil,
+    },
+    &command.CommandLineFlag{
+        "export",
+        "e",
+        "comma separated vars to export to the exec/supervise command env, var or var=ENV_NAME",
+        "vars",
+        false,
+        "",
+        nil,
+    },
 }
 var command_line_args = &command.CommandLineArgs{
-    []string{"[environment]"},
-    "If environment is not specified, default_environment from config is assumed",
+    []string{"[environment... | encrypt name [value] | decrypt name [value] | keygen | exec|supervise [environment] -- command [args] | watch [environment]]"},
+    "If environment is not specified, it is selected from config\n" +
+    "encrypt, decrypt, keygen, exec, supervise and watch are commands, not environment names\n" +
+    "Environment can be a comma separated stack, ie base,prod,prod-eu\n" +
+    "Multiple environments are rendered into their subdirs of output-base-dir,\n" +
+    "stacks into layers joined with -, ie base-prod\n" +
+    "encrypt and decrypt take the value of var name from stdin if not specified\n" +
+    "keygen prints a new encryption key\n" +
+    "exec processes the environment, then replaces gotiller with the command\n" +
+    "supervise runs the command, re-processing and signalling it on changes\n" +
+    "watch re-renders as config and templates change, needs --output-base-dir",
     nil,
 }
+
+// Run options, from the command line
+type options struct {
+    Dir           string
+    TargetBaseDir string
+    Verbose       bool
+    NoHostFuncs   bool
+    Export        string
+}
+
+// Commands that take the place of environment. Their names are reserved,
+// they cannot be given as environments.
+var subcommands = map[string]func(o *options, args []string){
+    "encrypt":   encryptCommand,
+    "decrypt":   decryptCommand,
+    "keygen":    keygenCommand,
+    "exec":      execCommand,
+    "supervise": superviseCommand,
+    "watch":     watchCommand,
+}
 func main() {
     command.Run(
         command_line_flags,
@@ -53,10 +127,15 @@ func main() {
             dir             := *command_line_flags[0].ValueP.(*string)
             target_base_dir := *command_line_flags[1].ValueP.(*string)
             verbose         := *command_line_flags[2].ValueP.(*bool)
+            lint            := *command_line_flags[3].ValueP.(*bool)
+            no_host_funcs   := *command_line_flags[4].ValueP.(*bool)
+            no_exec         := *command_line_flags[5].ValueP.(*bool)
+            key_file        := *command_line_flags[6].ValueP.(*string)
+            export          := *command_line_flags[7].ValueP.(*string)
             env             := ""
 
-            if len(command_line_args.Values) > 0 {
-                env = command_line_args.Values[0]
+            if key_file != "" {
+                sources.SetEncryptionKeyFile(key_file)
             }
 
             if dir == "" {
@@ -67,7 +146,41 @@ func main() {
                 }
             }
 
-            gotiller.Process(dir, env, target_base_dir, verbose)
+            if no_exec {
+                sources.EnableExecSources(false)
+            }
+
+            if len(command_line_args.Values) > 0 {
+                env = command_line_args.Values[0]
+                if subcommand, exists := subcommands[env]; exists {
+                    subcommand(&options{dir, target_base_dir, verbose, no_host_funcs, export}, command_line_args.Values[1:])
+                    return
+                }
+            }
+
+            if lint {
+                report := gotiller.Lint(dir, verbose, no_host_funcs)
+                report.Print(os.Stdout)
+                if !report.Empty() {
+                    os.Exit(1)
+                }
+                return
+            }
+
+            if len(command_line_args.Values) > 1 {
+                _, results := gotiller.ProcessEnvironments(dir, command_line_args.Values, target_base_dir, verbose, no_host_funcs)
+                for _, result := range results {
+                    if result.Failed() {
+                        os.Exit(1)
+                    }
+                }
+                return
+            }
+
+            _, result := gotiller.ProcessWithResult(dir, env, target_base_dir, verbose, no_host_funcs)
+            if result.Failed() {
+                os.Exit(1)
+            }
         },
     )
 }
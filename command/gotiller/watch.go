@@ -0,0 +1,20 @@
+// watch command
+
+package main
+
+import (
+    "github.com/catalyst/gotiller"
+)
+
+func watchCommand(o *options, args []string) {
+    w := gotiller.Watcher{
+        Dir:           o.Dir,
+        TargetBaseDir: o.TargetBaseDir,
+        Verbose:       o.Verbose,
+        NoHostFuncs:   o.NoHostFuncs,
+    }
+    if len(args) > 0 {
+        w.Environment = args[0]
+    }
+    w.Run(nil)
+}
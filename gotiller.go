@@ -3,14 +3,29 @@
 package gotiller
 
 import (
+    "path/filepath"
+    "strings"
+
     "github.com/catalyst/gotiller/sources"
     "github.com/catalyst/gotiller/log"
 )
 
 var logger = log.DefaultLogger
 
-// Process config files and templates
-func Process(dir string, environment string, target_base_dir string, verbose bool) *sources.Processor {
+// Environment to process, if not specified.
+// See Processor.SelectEnvironment.
+func resolveEnvironment(processor *sources.Processor, environment string) string {
+    if environment == "" {
+        environment = processor.SelectEnvironment()
+        if environment == "" {
+            logger.Println("Environment not specified, hope there are some defaults")
+        }
+    }
+    return environment
+}
+
+// Common Process prologue - loads config files from dir
+func loadConfigs(dir string, target_base_dir string, verbose bool, no_host_funcs bool) *sources.Processor {
     logger.Printf("Executing from %s\n", dir)
     if target_base_dir != "" {
         logger.Printf("Writing to %s\n", target_base_dir)
@@ -21,20 +36,73 @@ func Process(dir string, environment string, target_base_dir string, verbose boo
     }
 
     processor := sources.LoadConfigsFromDir(dir)
+    processor.NoHostFunctions = no_host_funcs
+    return processor
+}
 
-    if environment == "" {
-        if  processor.DefaultEnvironment != "" {
-            environment = processor.DefaultEnvironment
-            logger.Println("Executing for default environment")
-        } else {
-            logger.Println("Environment not specified, hope there are some defaults")
+// Process config files and templates.
+// Returns the processor, for forensic purposes.
+func Process(dir string, environment string, target_base_dir string, verbose bool) *sources.Processor {
+    processor, _ := ProcessWithResult(dir, environment, target_base_dir, verbose, false)
+    return processor
+}
+
+// As Process, also returns the run result.
+// With no_host_funcs templates cannot use host functions.
+func ProcessWithResult(dir string, environment string, target_base_dir string, verbose bool, no_host_funcs bool) (*sources.Processor, *sources.RunResult) {
+    processor := loadConfigs(dir, target_base_dir, verbose, no_host_funcs)
+
+    environment = resolveEnvironment(processor, environment)
+    logger.Printf("Executing for %s\n", environment)
+
+    result := processor.RunForEnvironment(environment, target_base_dir)
+
+    return processor, result
+}
+
+// Subdir name for an environment, stack layers joined with "-",
+// ie base,prod gives base-prod
+func EnvironmentDirName(environment string) string {
+    return strings.Join(sources.EnvironmentStack(environment), "-")
+}
+
+// Process for multiple environments, each into its own subdir of
+// target_base_dir, see EnvironmentDirName.
+func ProcessEnvironments(dir string, environments []string, target_base_dir string, verbose bool, no_host_funcs bool) (*sources.Processor, []*sources.RunResult) {
+    if target_base_dir == "" {
+        logger.Panic("Multiple environments need output base dir")
+    }
+    env_dirs := make(map[string]string)
+    for _, environment := range environments {
+        name := EnvironmentDirName(environment)
+        if other, exists := env_dirs[name]; exists {
+            logger.Panicf("Environments %s and %s both go into %s", other, environment, name)
         }
+        env_dirs[name] = environment
     }
 
-    logger.Printf("Executing for %s\n", environment)
+    processor := loadConfigs(dir, target_base_dir, verbose, no_host_funcs)
 
-    processor.RunForEnvironment(environment, target_base_dir)
+    var results []*sources.RunResult
+    for _, environment := range environments {
+        env_base_dir := filepath.Join(target_base_dir, EnvironmentDirName(environment))
+        logger.Printf("Executing for %s into %s\n", environment, env_base_dir)
+        results = append(results, processor.RunForEnvironment(environment, env_base_dir))
+    }
 
-    // for forensic purposes
-    return processor
+    return processor, results
+}
+
+// Lint config files and templates
+func Lint(dir string, verbose bool, no_host_funcs bool) *sources.LintReport {
+    logger.Printf("Linting %s\n", dir)
+
+    if verbose {
+        logger.SetDebug(true)
+    }
+
+    processor := sources.LoadConfigsFromDir(dir)
+    processor.NoHostFunctions = no_host_funcs
+
+    return processor.Lint()
 }
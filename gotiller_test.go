@@ -4,6 +4,9 @@ import (
     "os"
     "flag"
     "fmt"
+    "path/filepath"
+    "syscall"
+    "time"
 
     "testing"
     "github.com/stretchr/testify/assert"
@@ -61,3 +64,148 @@ func Test_ProcessNothing(t *testing.T) {
         Process(conf_dir, bogus_environment, target_dir, true)
     }, "Process() in bogus directory")
 }
+
+func Test_Supervise(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    conf_dir := t.TempDir()
+    target_dir := t.TempDir()
+    vars_path := filepath.Join(t.TempDir(), "vars.yaml")
+    signals_log := filepath.Join(target_dir, "signals.log")
+    pid_path := filepath.Join(target_dir, "child.pid")
+
+    util.Mkdir(filepath.Join(conf_dir, "templates"))
+    util.WriteFileAtomic(filepath.Join(conf_dir, "templates", "t.conf"), []byte("v={{.v}}\n"), 0644)
+    util.WriteFileAtomic(filepath.Join(conf_dir, sources.ConfigFname), []byte(
+        "defaults:\n" +
+        "  t.conf:\n" +
+        "    target: t.conf\n" +
+        "vars_files: [" + vars_path + "]\n" +
+        "supervise:\n" +
+        "  poll: 20ms\n" +
+        "  signal: USR1\n",
+    ), 0644)
+    util.WriteFileAtomic(vars_path, []byte("v: one\n"), 0644)
+
+    s := Supervisor{
+        Dir:           conf_dir,
+        Environment:   "prod",
+        TargetBaseDir: target_dir,
+        Args:          []string{"sh", "-c", "trap 'echo usr1 >> " + signals_log + "' USR1; echo $$ > " + pid_path + "; while true; do sleep 0.02; done"},
+        Export:        []string{"v"},
+    }
+    exit_code := make(chan int)
+    go func() { exit_code <- s.Run() }()
+
+    target := filepath.Join(target_dir, "t.conf")
+    assert.Eventually(t, func() bool { return util.IsFile(pid_path) }, 5 * time.Second, 20 * time.Millisecond, "child started")
+    assert.Equal(t, "v=one\n", string(util.SlurpFile(target)), "initial content")
+
+    util.WriteFileAtomic(vars_path, []byte("v: two\n"), 0644)
+    assert.Eventually(t, func() bool { return util.IsFile(signals_log) }, 5 * time.Second, 20 * time.Millisecond, "child signalled")
+    assert.Equal(t, "v=two\n", string(util.SlurpFile(target)), "re-rendered content")
+    assert.Equal(t, []string{"usr1"}, util.SlurpFileAsLines(signals_log), "signalled once")
+
+    pid := util.AtoI(util.SlurpFileAsLines(pid_path)[0])
+    syscall.Kill(pid, syscall.SIGTERM)
+    select {
+        case code := <-exit_code:
+            assert.Equal(t, 128 + int(syscall.SIGTERM), code, "child exit code")
+        case <-time.After(5 * time.Second):
+            assert.Fail(t, "child did not exit")
+    }
+}
+
+func Test_Watch(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    conf_dir := t.TempDir()
+    target_dir := t.TempDir()
+    templates_dir := filepath.Join(conf_dir, "templates")
+
+    util.Mkdir(templates_dir)
+    util.WriteFileAtomic(filepath.Join(templates_dir, "t1.conf"), []byte("t1 {{.v}}\n"), 0644)
+    util.WriteFileAtomic(filepath.Join(templates_dir, "t2.conf"), []byte("t2 {{.v}}\n"), 0644)
+    util.WriteFileAtomic(filepath.Join(conf_dir, sources.ConfigFname), []byte(
+        "defaults:\n" +
+        "  _vars:\n" +
+        "    v: one\n" +
+        "  t1.conf:\n" +
+        "    target: t1.conf\n" +
+        "  t2.conf:\n" +
+        "    target: t2.conf\n",
+    ), 0644)
+
+    w := Watcher{Dir: conf_dir, Environment: "dev", TargetBaseDir: target_dir, Poll: 20 * time.Millisecond}
+    stop := make(chan struct{})
+    done := make(chan struct{})
+    go func() {
+        w.Run(stop)
+        close(done)
+    }()
+
+    t1 := filepath.Join(target_dir, "t1.conf")
+    t2 := filepath.Join(target_dir, "t2.conf")
+    content_is := func(path string, expected string) func() bool {
+        return func() bool { return util.IsFile(path) && string(util.SlurpFile(path)) == expected }
+    }
+    assert.Eventually(t, content_is(t2, "t2 one\n"), 5 * time.Second, 20 * time.Millisecond, "initial render")
+    os.Remove(t2)
+
+    // Only affected template is rendered
+    util.WriteFileAtomic(filepath.Join(templates_dir, "t1.conf"), []byte("t1 {{.v}} edited\n"), 0644)
+    assert.Eventually(t, content_is(t1, "t1 one edited\n"), 5 * time.Second, 20 * time.Millisecond, "template edited")
+    assert.False(t, util.IsFile(t2), "unaffected template not rendered")
+
+    // Errors do not stop watching
+    util.WriteFileAtomic(filepath.Join(templates_dir, "t1.conf"), []byte("t1 {{.v\n"), 0644)
+    time.Sleep(100 * time.Millisecond)
+    util.WriteFileAtomic(filepath.Join(conf_dir, sources.ConfigFname), []byte(
+        "defaults:\n" +
+        "  _vars:\n" +
+        "    v: two\n" +
+        "  t2.conf:\n" +
+        "    target: t2.conf\n",
+    ), 0644)
+    assert.Eventually(t, content_is(t2, "t2 two\n"), 5 * time.Second, 20 * time.Millisecond, "config edited after error")
+
+    close(stop)
+    <-done
+
+    assert.Panics(t, func() { (&Watcher{Dir: conf_dir}).Run(stop) }, "no output base dir")
+}
+
+func Test_ProcessEnvironments(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    conf_dir := t.TempDir()
+    target_dir := t.TempDir()
+
+    util.Mkdir(filepath.Join(conf_dir, "templates"))
+    util.WriteFileAtomic(filepath.Join(conf_dir, "templates", "t.conf"), []byte("{{.environment}} {{.v}}\n"), 0644)
+    util.WriteFileAtomic(filepath.Join(conf_dir, sources.ConfigFname), []byte(
+        "defaults:\n" +
+        "  _vars:\n" +
+        "    v: default\n" +
+        "  t.conf:\n" +
+        "    target: t.conf\n" +
+        "environments:\n" +
+        "  prod:\n" +
+        "    _vars:\n" +
+        "      v: prod\n" +
+        "  eu: {}\n",
+    ), 0644)
+
+    _, results := ProcessEnvironments(conf_dir, []string{"dev", "prod,eu"}, target_dir, false, false)
+    assert.Equal(t, 2, len(results), "results")
+    assert.Equal(t, "dev default\n", string(util.SlurpFile(filepath.Join(target_dir, "dev", "t.conf"))), "dev")
+    assert.Equal(t, "eu prod\n", string(util.SlurpFile(filepath.Join(target_dir, "prod-eu", "t.conf"))), "prod,eu stack")
+
+    processor, result := ProcessWithResult(conf_dir, "prod", t.TempDir(), false, false)
+    assert.Equal(t, "prod", result.Environment, "single environment result")
+    assert.Equal(t, 1, len(result.Deployed), "single environment deployed")
+    assert.NotNil(t, processor, "single environment processor")
+
+    assert.Panics(t, func() { ProcessEnvironments(conf_dir, []string{"dev", "prod"}, "", false, false) }, "no output base dir")
+    assert.Panics(t, func() { ProcessEnvironments(conf_dir, []string{"prod,eu", "prod-eu"}, target_dir, false, false) }, "same subdir")
+}
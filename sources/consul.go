@@ -0,0 +1,142 @@
+// Infrastructure for Consul KV
+
+package sources
+
+import (
+    "encoding/base64"
+    "net/url"
+    "os"
+    "strings"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const DefaultConsulAddress = "http://127.0.0.1:8500"
+
+// Consul KV Source. Keys under Prefix are fetched per environment, when needed.
+type ConsulSource struct {
+    Address    string
+    Token      string
+    TokenFile  string
+    Datacenter string
+    Prefix     string
+    Optional   bool
+    HTTP       *util.HTTPClientConfig
+
+    EnvironmentDeployables
+    BaseSource
+}
+func (c *ConsulSource) MergeConfig(origin string, config interface{}) {
+    c_m := config.(util.AnyMap)
+    c.AddHistory(origin, c_m)
+
+    fields := map[string]*string{
+        "address":    &c.Address,
+        "token":      &c.Token,
+        "token_file": &c.TokenFile,
+        "datacenter": &c.Datacenter,
+        "prefix":     &c.Prefix,
+    }
+    for k, f := range fields {
+        if v, exists := c_m[k]; exists {
+            *f = util.ToString(v)
+        }
+    }
+    c.Address = strings.TrimSuffix(c.Address, "/")
+    if v, exists := c_m["optional"]; exists {
+        c.Optional = v.(bool)
+    }
+    c.HTTP.Merge(c_m)
+}
+
+func (c *ConsulSource) headers() map[string]string {
+    h := make(map[string]string)
+    token := valueOrFile(c.Token, c.TokenFile)
+    if token == "" {
+        token = os.Getenv("CONSUL_HTTP_TOKEN")
+    }
+    if token != "" {
+        h["X-Consul-Token"] = token
+    }
+    return h
+}
+
+// Reads all keys under prefix. Returns nil if there are none.
+func (c *ConsulSource) Read(prefix string) map[string]string {
+    address := c.Address
+    if address == "" {
+        address = os.Getenv("CONSUL_HTTP_ADDR")
+    }
+    if address == "" {
+        address = DefaultConsulAddress
+    }
+    if !strings.Contains(address, "://") {
+        address = "http://" + address
+    }
+
+    query := url.Values{"recurse": []string{"true"}}
+    if c.Datacenter != "" {
+        query.Set("dc", c.Datacenter)
+    }
+    kv_url := address + "/v1/kv/" + strings.TrimPrefix(prefix, "/") + "?" + query.Encode()
+    logger.Debugf("Reading Consul keys %s\n", kv_url)
+
+    var entries []struct {
+        Key   string
+        Value *string
+    }
+    if err := util.HTTPRequestJSON(c.HTTP.Client(), "GET", kv_url, c.headers(), nil, &entries); err != nil {
+        if se, ok := err.(*util.HTTPStatusError); ok && se.StatusCode == 404 {
+            return nil
+        }
+        panic(err)
+    }
+
+    kv := make(map[string]string)
+    for _, e := range entries {
+        // Folders have no value
+        if e.Value == nil || strings.HasSuffix(e.Key, "/") {
+            continue
+        }
+        val, err := base64.StdEncoding.DecodeString(*e.Value)
+        if err != nil {
+            logger.Panicf("Consul key %s: %s", e.Key, err)
+        }
+        kv[e.Key] = string(val)
+    }
+    return kv
+}
+
+func (c *ConsulSource) DeployablesForEnvironment(environment string) *Deployables {
+    if c.Prefix == "" {
+        return nil
+    }
+    if d, exists := c.EnvironmentDeployables[environment]; exists {
+        return d
+    }
+
+    // Consul keys have no leading "/"
+    prefix := strings.TrimPrefix(FolderPrefix(ExpandForEnvironment(c.Prefix, environment)), "/")
+    kv := c.Read(prefix)
+    if kv == nil {
+        if !c.Optional {
+            logger.Panicf("Consul prefix %s not found", prefix)
+        }
+        logger.Debugf("Optional Consul prefix %s not found\n", prefix)
+    }
+
+    deployables := KeysDeployablesMap(kv, prefix)
+    c.AddHistory("consul " + prefix, deployables)
+
+    d := MakeDeployables(deployables)
+    c.EnvironmentDeployables[environment] = d
+    return d
+}
+
+func MakeConsulSource() SourceInterface {
+    return &ConsulSource{HTTP: &util.HTTPClientConfig{}, EnvironmentDeployables: make(EnvironmentDeployables), BaseSource: MakeBaseSource()}
+}
+
+func init() {
+    RegisterSource("consul", MakeConsulSource, 60, false)
+}
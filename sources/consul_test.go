@@ -0,0 +1,92 @@
+package sources
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+// Minimal Consul KV API stand-in, recurse reads only
+func consulTestServer(t *testing.T, kv map[string]string) *httptest.Server {
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("X-Consul-Token") != "t0ken" {
+            http.Error(w, "ACL not found", http.StatusForbidden)
+            return
+        }
+        assert.Equal(t, "true", r.URL.Query().Get("recurse"), "consul recurse")
+        assert.Equal(t, "dc1", r.URL.Query().Get("dc"), "consul datacenter")
+
+        prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+        var entries []util.AnyMap
+        for k, v := range kv {
+            if !strings.HasPrefix(k, prefix) {
+                continue
+            }
+            entry := util.AnyMap{"Key": k, "Value": nil}
+            if !strings.HasSuffix(k, "/") {
+                entry["Value"] = base64.StdEncoding.EncodeToString([]byte(v))
+            }
+            entries = append(entries, entry)
+        }
+        if len(entries) == 0 {
+            http.NotFound(w, r)
+            return
+        }
+        json.NewEncoder(w).Encode(entries)
+    }))
+}
+
+func Test_ConsulSource(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    server := consulTestServer(t, map[string]string{
+        "config/prod/": "",
+        "config/prod/port": "8080",
+        "config/prod/db/host": "dbhost",
+        "config/prod/db/name": "dbname",
+        "config/production/port": "8081",
+        "config/test/_vars/port": "8081",
+        "config/test/t1.conf/vars/v1": "t1v1",
+        "config/test/t1.conf/target": "t1.out",
+    })
+    defer server.Close()
+
+    cs := MakeConsulSource()
+    cs.MergeConfig("test", util.AnyMap{
+        "address": server.URL,
+        "token": "t0ken",
+        "datacenter": "dc1",
+        "prefix": "config/{{environment}}",
+    })
+
+    d := cs.DeployablesForEnvironment("prod")
+    assert.Equal(t, Vars{"port": "8080", "db.host": "dbhost", "db.name": "dbname"}, d.Vars, "consul nested vars")
+    assert.Empty(t, d.Specs, "consul specs")
+
+    d = cs.DeployablesForEnvironment("test")
+    assert.Equal(t, Vars{"port": "8081"}, d.Vars, "consul _vars")
+    assert.Equal(t, Vars{"v1": "t1v1"}, d.Specs["t1.conf"].Vars, "consul template vars")
+    assert.Equal(t, "t1.out", d.Specs["t1.conf"].Target, "consul template target")
+
+    cs = MakeConsulSource()
+    cs.MergeConfig("test", util.AnyMap{
+        "address": server.URL,
+        "token": "t0ken",
+        "datacenter": "dc1",
+        "prefix": "/config/{{environment}}",
+    })
+    assert.Equal(t, Vars{"port": "8080", "db.host": "dbhost", "db.name": "dbname"}, cs.DeployablesForEnvironment("prod").Vars, "consul prefix with leading /")
+
+    assert.Panics(t, func() { cs.DeployablesForEnvironment("missing") }, "missing consul prefix")
+
+    cs.MergeConfig("test", util.AnyMap{"optional": true})
+    assert.Empty(t, cs.DeployablesForEnvironment("missing").Vars, "optional consul prefix")
+
+    assert.Nil(t, MakeConsulSource().DeployablesForEnvironment("prod"), "consul without prefix")
+}
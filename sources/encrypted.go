@@ -0,0 +1,80 @@
+// Encrypted var values. Config files can hold ENC[...] values, decrypted
+// at load time with a key from a file or env var.
+
+package sources
+
+import (
+    "os"
+    "sync"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const (
+    EncryptionKeyEnvVar     = "GOTILLER_KEY"
+    EncryptionKeyFileEnvVar = "GOTILLER_KEY_FILE"
+)
+
+var encryption_key = struct {
+    sync.Mutex
+    file string
+    key  []byte
+}{}
+
+// Sets the key file, trumping env vars
+func SetEncryptionKeyFile(path string) {
+    encryption_key.Lock()
+    defer encryption_key.Unlock()
+
+    encryption_key.file = path
+    encryption_key.key = nil
+}
+
+// The key from the key file, GOTILLER_KEY_FILE or GOTILLER_KEY, in that order
+func EncryptionKey() []byte {
+    encryption_key.Lock()
+    defer encryption_key.Unlock()
+
+    if encryption_key.key != nil {
+        return encryption_key.key
+    }
+
+    var (
+        key_s  string
+        origin string
+    )
+    switch {
+        case encryption_key.file != "":
+            origin = encryption_key.file
+            key_s = string(util.SlurpFile(origin))
+        case os.Getenv(EncryptionKeyFileEnvVar) != "":
+            origin = os.Getenv(EncryptionKeyFileEnvVar)
+            key_s = string(util.SlurpFile(origin))
+        case os.Getenv(EncryptionKeyEnvVar) != "":
+            origin = EncryptionKeyEnvVar
+            key_s = os.Getenv(EncryptionKeyEnvVar)
+        default:
+            logger.Panicf("No encryption key, set %s or %s", EncryptionKeyFileEnvVar, EncryptionKeyEnvVar)
+    }
+
+    key, err := util.ParseEncryptionKey(key_s)
+    if err != nil {
+        logger.Panicf("%s: %s", origin, err)
+    }
+    encryption_key.key = key
+    return key
+}
+
+// Decrypts the value if encrypted, and marks the var sensitive
+func DecryptVar(name string, value string) string {
+    if !util.IsEncrypted(value) {
+        return value
+    }
+
+    MarkSensitive(name)
+    plaintext, err := util.Decrypt(EncryptionKey(), name, value)
+    if err != nil {
+        logger.Panicf("Var %s: %s", name, err)
+    }
+    return plaintext
+}
@@ -0,0 +1,62 @@
+package sources
+
+import (
+    "encoding/base64"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+func Test_EncryptedVars(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    key_s := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", util.EncryptionKeySize)))
+    key, err := util.ParseEncryptionKey(key_s)
+    assert.NoError(t, err, "parse key")
+
+    dir := t.TempDir()
+    key_file := filepath.Join(dir, "key")
+    util.WriteFile(key_file, []byte(key_s + "\n"))
+    SetEncryptionKeyFile(key_file)
+    defer SetEncryptionKeyFile("")
+
+    enc := util.Encrypt(key, "db.password", "pa55word")
+    assert.True(t, util.IsEncrypted(enc), "encrypted envelope")
+    assert.NotEqual(t, enc, util.Encrypt(key, "db.password", "pa55word"), "random nonce")
+
+    vars := MakeVars(util.AnyMap{"db.password": enc, "user": "app"})
+    assert.Equal(t, Vars{"db.password": "pa55word", "user": "app"}, vars, "decrypted vars")
+    assert.True(t, IsSensitive("db.password"), "decrypted var is sensitive")
+    assert.False(t, IsSensitive("user"), "plain var is not sensitive")
+
+    tampered := enc[:len(enc) - 3] + "AA]"
+    assert.Panics(t, func() { MakeVars(util.AnyMap{"db.password": tampered}) }, "tampered value")
+    assert.Panics(t, func() { MakeVars(util.AnyMap{"user": enc}) }, "value moved to another var")
+
+    other_key, _ := util.ParseEncryptionKey(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("o", util.EncryptionKeySize))))
+    _, err = util.Decrypt(other_key, "db.password", enc)
+    assert.Error(t, err, "wrong key")
+    _, err = util.Decrypt(key, "user", enc)
+    assert.Error(t, err, "wrong var name")
+
+    SetEncryptionKeyFile("")
+    os.Unsetenv(EncryptionKeyFileEnvVar)
+    os.Setenv(EncryptionKeyEnvVar, key_s)
+    defer os.Unsetenv(EncryptionKeyEnvVar)
+    assert.Equal(t, "pa55word", MakeVars(util.AnyMap{"db.password": enc})["db.password"], "key from env var")
+
+    os.Unsetenv(EncryptionKeyEnvVar)
+    SetEncryptionKeyFile("")
+    assert.Panics(t, func() { MakeVars(util.AnyMap{"db.password": enc}) }, "no key")
+
+    _, err = util.ParseEncryptionKey("c2hvcnQ=")
+    assert.Error(t, err, "short key")
+
+    new_key, err := util.ParseEncryptionKey(util.GenerateEncryptionKey())
+    assert.NoError(t, err, "generated key")
+    assert.NotEqual(t, key, new_key, "random generated key")
+}
@@ -9,23 +9,102 @@ import (
     "github.com/catalyst/gotiller/util"
 )
 
-// An env vars version of DeployablesSource type. NOSpecs, just Vars.
-type EnvVarsSource struct {
-    *DeployablesSource
+// An env_vars_prefix entry.
+// With Lowercase, env var names are lowercased before checking the prefix.
+// Map maps env var names to var names, regardless of the prefix.
+// If Template is set, vars go to the template vars, otherwise to global vars.
+type EnvVarsPrefix struct {
+    Prefix      string
+    Lowercase   bool
+    StripPrefix bool
+    Template    string
+    Map         map[string]string
 }
-func (v *EnvVarsSource) MergeConfig(origin string, prefix interface{}) {
-    prefix_s := prefix.(string)
-    logger.Debugf("Merging env %s vars from %s\n", prefix_s, origin)
+func MakeEnvVarsPrefix(c interface{}) *EnvVarsPrefix {
+    p := EnvVarsPrefix{StripPrefix: true}
 
+    switch c_t := c.(type) {
+        case string:
+            p.Prefix = c_t
+        case util.AnyMap:
+            p.Prefix = util.ToString(c_t["prefix"])
+            p.Lowercase, _ = c_t["lowercase"].(bool)
+            if v, exists := c_t["strip_prefix"]; exists {
+                p.StripPrefix = v.(bool)
+            }
+            p.Template = util.ToString(c_t["template"])
+            if m, exists := c_t["map"]; exists {
+                p.Map = make(map[string]string)
+                for n, v := range m.(util.AnyMap) {
+                    p.Map[n] = util.ToString(v)
+                }
+            }
+        default:
+            logger.Panicf("Invalid env_vars_prefix %v", c)
+    }
+
+    if p.Prefix == "" && len(p.Map) == 0 {
+        logger.Panicf("env_vars_prefix needs prefix or map %v", c)
+    }
+    if p.Lowercase {
+        p.Prefix = strings.ToLower(p.Prefix)
+    }
+    return &p
+}
+
+// Vars from env
+func (p *EnvVarsPrefix) Vars() util.AnyMap {
     env_vars := make(util.AnyMap)
     for _, e := range os.Environ() {
         pair := strings.SplitN(e, "=", 2)
-        if name := pair[0]; strings.HasPrefix(name, prefix_s) {
-            env_vars[strings.TrimPrefix(name, prefix_s)] = pair[1]
+        name := pair[0]
+        if var_name, exists := p.Map[name]; exists {
+            env_vars[var_name] = pair[1]
+            continue
+        }
+
+        if p.Prefix == "" {
+            continue
+        }
+        if p.Lowercase {
+            name = strings.ToLower(name)
+        }
+        if strings.HasPrefix(name, p.Prefix) {
+            if p.StripPrefix {
+                name = strings.TrimPrefix(name, p.Prefix)
+            }
+            env_vars[name] = pair[1]
         }
     }
-    deployables := util.AnyMap{GlobalVarsKey: env_vars}
-    v.DeployablesSource.MergeConfig(origin + " env_vars " + prefix_s, deployables)
+    return env_vars
+}
+
+// env_vars_prefix config entries
+func EnvVarsPrefixes(c interface{}) []*EnvVarsPrefix {
+    var prefixes []*EnvVarsPrefix
+    if c_l, is_list := c.([]interface{}); is_list {
+        for _, e := range c_l {
+            prefixes = append(prefixes, MakeEnvVarsPrefix(e))
+        }
+    } else {
+        prefixes = append(prefixes, MakeEnvVarsPrefix(c))
+    }
+    return prefixes
+}
+
+// An env vars version of DeployablesSource type.
+// Config is a prefix string, an entry map, or a list of those.
+type EnvVarsSource struct {
+    *DeployablesSource
+}
+func (v *EnvVarsSource) MergeConfig(origin string, prefix interface{}) {
+    for _, p := range EnvVarsPrefixes(prefix) {
+        logger.Debugf("Merging env %s vars from %s\n", p.Prefix, origin)
+
+        deployables := make(util.AnyMap)
+        MergeVarsInto(deployables, p.Template, p.Vars())
+        v.DeployablesSource.MergeConfig(origin + " env_vars " + p.Prefix, deployables)
+    }
 }
 
 func MakeEnvVarsSource() SourceInterface {
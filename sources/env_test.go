@@ -4,6 +4,7 @@ import (
     "testing"
 
     "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
 )
 
 const env_vars_prefix string = "gotiller_test_"
@@ -24,3 +25,29 @@ func Test_EnvVarsSource(t *testing.T) {
 
     assert.Equal(t, Vars{var_a: var_a}, evs.(*EnvVarsSource).DeployablesSource.Vars, "Test_EnvVarsSource.()")
 }
+
+func Test_EnvVarsPrefixes(t *testing.T) {
+    ep := EnvForPrefix(env_vars_prefix)
+    defer ep.Clear()
+    ep.Clear()
+    ep.Set("a", "a")
+    ep.Set("B_c", "bc")
+    ep.Set("mapped", "m")
+
+    evs := MakeEnvVarsSource()
+    evs.MergeConfig("test", []interface{}{
+        util.AnyMap{"prefix": "GOTILLER_TEST_B_", "lowercase": true},
+        util.AnyMap{"prefix": env_vars_prefix, "strip_prefix": false, "template": "t1.conf"},
+        util.AnyMap{"map": util.AnyMap{env_vars_prefix + "mapped": "m1"}},
+    })
+
+    d := evs.(*EnvVarsSource).DeployablesSource.Deployables
+    assert.Equal(t, Vars{"c": "bc", "m1": "m"}, d.Vars, "lowercased and mapped env vars")
+    assert.Equal(t, Vars{
+        env_vars_prefix + "a": "a",
+        env_vars_prefix + "B_c": "bc",
+        env_vars_prefix + "mapped": "m",
+    }, d.Specs["t1.conf"].Vars, "template env vars, prefix not stripped")
+
+    assert.Panics(t, func() { MakeEnvVarsSource().MergeConfig("test", util.AnyMap{"lowercase": true}) }, "no prefix nor map")
+}
@@ -0,0 +1,89 @@
+// Environment selection - from an env var, or hostname/env var rules
+
+package sources
+
+import (
+    "os"
+    "regexp"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+// An environment_rules entry. Match is checked against the hostname, or
+// Env var value if set. Environment can refer to Match groups, ie $1.
+type EnvironmentRule struct {
+    Env         string
+    Match       *regexp.Regexp
+    Environment string
+}
+// Config is a map with hostname: regex, or env: name and match: regex,
+// and environment keys.
+func MakeEnvironmentRule(c interface{}) *EnvironmentRule {
+    c_m, is_map := c.(util.AnyMap)
+    if !is_map {
+        logger.Panicf("Invalid environment rule %v", c)
+    }
+
+    r := EnvironmentRule{Environment: util.ToString(c_m["environment"])}
+    var match string
+    if h, exists := c_m["hostname"]; exists {
+        match = util.ToString(h)
+    } else {
+        r.Env = util.ToString(c_m["env"])
+        match = util.ToString(c_m["match"])
+    }
+    if match == "" || r.Environment == "" {
+        logger.Panicf("Environment rule needs hostname or env and match, and environment %v", c)
+    }
+    r.Match = regexp.MustCompile(match)
+    return &r
+}
+func MakeEnvironmentRules(c interface{}) []*EnvironmentRule {
+    c_l, is_list := c.([]interface{})
+    if !is_list {
+        logger.Panicf("environment_rules must be a list %v", c)
+    }
+    var rules []*EnvironmentRule
+    for _, r := range c_l {
+        rules = append(rules, MakeEnvironmentRule(r))
+    }
+    return rules
+}
+
+// Environment if the rule matches, otherwise ""
+func (r *EnvironmentRule) Apply() string {
+    s := util.Hostname()
+    if r.Env != "" {
+        var exists bool
+        if s, exists = os.LookupEnv(r.Env); !exists {
+            return ""
+        }
+    }
+
+    m := r.Match.FindStringSubmatchIndex(s)
+    if m == nil {
+        return ""
+    }
+    return string(r.Match.ExpandString(nil, r.Environment, s, m))
+}
+
+// Environment from EnvironmentFromEnv env var, or the first matching
+// EnvironmentRules, or DefaultEnvironment. Returns "" if none applies.
+func (p *Processor) SelectEnvironment() string {
+    if p.EnvironmentFromEnv != "" {
+        if e := os.Getenv(p.EnvironmentFromEnv); e != "" {
+            logger.Printf("Environment from %s env var\n", p.EnvironmentFromEnv)
+            return e
+        }
+    }
+    for _, r := range p.EnvironmentRules {
+        if e := r.Apply(); e != "" {
+            logger.Printf("Environment from rule %s\n", r.Match)
+            return e
+        }
+    }
+    if p.DefaultEnvironment != "" {
+        logger.Println("Executing for default environment")
+    }
+    return p.DefaultEnvironment
+}
@@ -0,0 +1,51 @@
+package sources
+
+import (
+    "os"
+    "regexp"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+func Test_SelectEnvironment(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    hostname := util.Hostname()
+    os.Unsetenv("GOTILLER_TEST_APP_ENV")
+    os.Setenv("GOTILLER_TEST_STAGE", "stage-qa")
+    defer os.Unsetenv("GOTILLER_TEST_STAGE")
+
+    p := NewProcessor()
+    assert.Equal(t, "", p.SelectEnvironment(), "nothing configured")
+
+    p.MergeConfig("test", util.AnyMap{
+        "default_environment": "dev",
+        "environment_from_env": "GOTILLER_TEST_APP_ENV",
+        "environment_rules": []interface{}{
+            util.AnyMap{"hostname": "^no-such-host-", "environment": "prod"},
+            util.AnyMap{"env": "GOTILLER_TEST_NO_SUCH_VAR", "match": ".*", "environment": "never"},
+            util.AnyMap{"env": "GOTILLER_TEST_STAGE", "match": `^stage-(\w+)$`, "environment": "$1"},
+        },
+    })
+    assert.Equal(t, "qa", p.SelectEnvironment(), "env rule with group")
+
+    os.Setenv("GOTILLER_TEST_APP_ENV", "prod")
+    defer os.Unsetenv("GOTILLER_TEST_APP_ENV")
+    assert.Equal(t, "prod", p.SelectEnvironment(), "environment_from_env first")
+    os.Unsetenv("GOTILLER_TEST_APP_ENV")
+
+    p.EnvironmentRules = nil
+    p.MergeConfig("test", util.AnyMap{
+        "environment_rules": []interface{}{
+            util.AnyMap{"hostname": "^" + regexp.QuoteMeta(hostname) + "$", "environment": "host"},
+        },
+    })
+    assert.Equal(t, "host", p.SelectEnvironment(), "hostname rule")
+
+    p.EnvironmentRules = nil
+    assert.Equal(t, "dev", p.SelectEnvironment(), "default_environment last")
+
+    assert.Panics(t, func() { MakeEnvironmentRule(util.AnyMap{"hostname": "x"}) }, "rule without environment")
+}
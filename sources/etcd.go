@@ -0,0 +1,175 @@
+// Infrastructure for etcd v3, over the JSON gRPC gateway
+
+package sources
+
+import (
+    "encoding/base64"
+    "os"
+    "strings"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const DefaultEtcdEndpoint = "http://127.0.0.1:2379"
+
+// etcd Source. Keys under Prefix are fetched per environment, when needed.
+type EtcdSource struct {
+    Endpoint     string
+    Username     string
+    Password     string
+    PasswordFile string
+    Prefix       string
+    Optional     bool
+    HTTP         *util.HTTPClientConfig
+
+    token string
+    EnvironmentDeployables
+    BaseSource
+}
+func (e *EtcdSource) MergeConfig(origin string, c interface{}) {
+    c_m := c.(util.AnyMap)
+    e.AddHistory(origin, c_m)
+
+    fields := map[string]*string{
+        "endpoint":      &e.Endpoint,
+        "username":      &e.Username,
+        "password":      &e.Password,
+        "password_file": &e.PasswordFile,
+        "prefix":        &e.Prefix,
+    }
+    for k, f := range fields {
+        if v, exists := c_m[k]; exists {
+            *f = util.ToString(v)
+        }
+    }
+    e.Endpoint = strings.TrimSuffix(e.Endpoint, "/")
+    if v, exists := c_m["optional"]; exists {
+        e.Optional = v.(bool)
+    }
+    e.HTTP.Merge(c_m)
+}
+
+func (e *EtcdSource) endpoint() string {
+    endpoint := e.Endpoint
+    if endpoint == "" {
+        // etcdctl style comma separated list, first one is good enough
+        endpoint = strings.Split(os.Getenv("ETCDCTL_ENDPOINTS"), ",")[0]
+    }
+    if endpoint == "" {
+        endpoint = DefaultEtcdEndpoint
+    }
+    if !strings.Contains(endpoint, "://") {
+        endpoint = "http://" + endpoint
+    }
+    return strings.TrimSuffix(endpoint, "/")
+}
+
+func (e *EtcdSource) headers() map[string]string {
+    h := make(map[string]string)
+    if e.token != "" {
+        h["Authorization"] = e.token
+    }
+    return h
+}
+
+func (e *EtcdSource) authenticate() {
+    if e.token != "" || e.Username == "" {
+        return
+    }
+
+    auth := map[string]string{
+        "name":     e.Username,
+        "password": valueOrFile(e.Password, e.PasswordFile),
+    }
+    var resp struct {
+        Token string `json:"token"`
+    }
+    url := e.endpoint() + "/v3/auth/authenticate"
+    logger.Debugf("etcd authenticate %s\n", url)
+    if err := util.HTTPRequestJSON(e.HTTP.Client(), "POST", url, nil, auth, &resp); err != nil {
+        panic(err)
+    }
+    e.token = resp.Token
+}
+
+// End of the range of all keys with the prefix
+func prefixRangeEnd(prefix string) string {
+    end := []byte(prefix)
+    for i := len(end) - 1; i >= 0; i-- {
+        if end[i] < 0xff {
+            end[i]++
+            return string(end[:i + 1])
+        }
+    }
+    // All keys
+    return "\x00"
+}
+
+// Reads all keys under prefix
+func (e *EtcdSource) Read(prefix string) map[string]string {
+    e.authenticate()
+
+    b64 := base64.StdEncoding.EncodeToString
+    req := map[string]string{
+        "key":       b64([]byte(prefix)),
+        "range_end": b64([]byte(prefixRangeEnd(prefix))),
+    }
+    var resp struct {
+        Kvs []struct {
+            Key   string `json:"key"`
+            Value string `json:"value"`
+        } `json:"kvs"`
+    }
+    url := e.endpoint() + "/v3/kv/range"
+    logger.Debugf("Reading etcd keys %s from %s\n", prefix, url)
+    if err := util.HTTPRequestJSON(e.HTTP.Client(), "POST", url, e.headers(), req, &resp); err != nil {
+        panic(err)
+    }
+
+    kv := make(map[string]string)
+    for _, item := range resp.Kvs {
+        k, err := base64.StdEncoding.DecodeString(item.Key)
+        if err != nil {
+            panic(err)
+        }
+        v, err := base64.StdEncoding.DecodeString(item.Value)
+        if err != nil {
+            panic(err)
+        }
+        kv[string(k)] = string(v)
+    }
+    return kv
+}
+
+func (e *EtcdSource) DeployablesForEnvironment(environment string) *Deployables {
+    if e.Prefix == "" {
+        return nil
+    }
+    if d, exists := e.EnvironmentDeployables[environment]; exists {
+        return d
+    }
+
+    prefix := FolderPrefix(ExpandForEnvironment(e.Prefix, environment))
+    kv := e.Read(prefix)
+    if len(kv) == 0 {
+        if !e.Optional {
+            logger.Panicf("etcd prefix %s not found", prefix)
+        }
+        logger.Debugf("Optional etcd prefix %s not found\n", prefix)
+    }
+
+    deployables := KeysDeployablesMap(kv, prefix)
+    e.AddHistory("etcd " + prefix, deployables)
+
+    d := MakeDeployables(deployables)
+    e.EnvironmentDeployables[environment] = d
+    return d
+}
+
+func MakeEtcdSource() SourceInterface {
+    return &EtcdSource{HTTP: &util.HTTPClientConfig{}, EnvironmentDeployables: make(EnvironmentDeployables), BaseSource: MakeBaseSource()}
+}
+
+func init() {
+    RegisterSource("etcd", MakeEtcdSource, 65, false)
+}
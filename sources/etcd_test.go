@@ -0,0 +1,92 @@
+package sources
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+// Minimal etcd v3 JSON gateway stand-in: authenticate and range reads
+func etcdTestServer(t *testing.T, kv map[string]string) *httptest.Server {
+    return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var req map[string]string
+        json.NewDecoder(r.Body).Decode(&req)
+
+        switch r.URL.Path {
+            case "/v3/auth/authenticate":
+                if req["name"] != "gotiller" || req["password"] != "pa55" {
+                    http.Error(w, `{"error":"authentication failed"}`, http.StatusBadRequest)
+                    return
+                }
+                json.NewEncoder(w).Encode(util.AnyMap{"token": "t0ken"})
+            case "/v3/kv/range":
+                if r.Header.Get("Authorization") != "t0ken" {
+                    http.Error(w, `{"error":"user name is empty"}`, http.StatusUnauthorized)
+                    return
+                }
+                key, _ := base64.StdEncoding.DecodeString(req["key"])
+                range_end, _ := base64.StdEncoding.DecodeString(req["range_end"])
+
+                var kvs []util.AnyMap
+                for k, v := range kv {
+                    if k >= string(key) && k < string(range_end) {
+                        kvs = append(kvs, util.AnyMap{
+                            "key": base64.StdEncoding.EncodeToString([]byte(k)),
+                            "value": base64.StdEncoding.EncodeToString([]byte(v)),
+                        })
+                    }
+                }
+                json.NewEncoder(w).Encode(util.AnyMap{"kvs": kvs, "count": len(kvs)})
+            default:
+                http.NotFound(w, r)
+        }
+    }))
+}
+
+func Test_EtcdSource(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    server := etcdTestServer(t, map[string]string{
+        "/config/prod/port": "8080",
+        "/config/prod/db/host": "dbhost",
+        "/config/production/port": "8081",
+        "/config/test/_vars/port": "8082",
+        "/config/test/t1.conf/vars/v1": "t1v1",
+    })
+    defer server.Close()
+
+    ca_file := filepath.Join(t.TempDir(), "ca.pem")
+    util.WriteFile(ca_file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+    es := MakeEtcdSource()
+    es.MergeConfig("test", util.AnyMap{
+        "endpoint": server.URL,
+        "username": "gotiller",
+        "password": "pa55",
+        "ca_file": ca_file,
+        "prefix": "/config/{{environment}}",
+    })
+
+    d := es.DeployablesForEnvironment("prod")
+    assert.Equal(t, Vars{"port": "8080", "db.host": "dbhost"}, d.Vars, "etcd nested vars")
+
+    d = es.DeployablesForEnvironment("test")
+    assert.Equal(t, Vars{"port": "8082"}, d.Vars, "etcd _vars")
+    assert.Equal(t, Vars{"v1": "t1v1"}, d.Specs["t1.conf"].Vars, "etcd template vars")
+
+    assert.Panics(t, func() { es.DeployablesForEnvironment("missing") }, "missing etcd prefix")
+
+    es = MakeEtcdSource()
+    es.MergeConfig("test", util.AnyMap{"endpoint": server.URL, "prefix": "/config/prod/"})
+    assert.Panics(t, func() { es.DeployablesForEnvironment("prod") }, "etcd server not trusted")
+
+    assert.Equal(t, "/config0", prefixRangeEnd("/config/"), "prefix range end")
+    assert.Equal(t, "b", prefixRangeEnd("a\xff"), "prefix range end overflow")
+}
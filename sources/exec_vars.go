@@ -0,0 +1,152 @@
+// Infrastructure for taking vars from commands' output
+
+package sources
+
+import (
+    "os"
+    "strings"
+    "time"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const (
+    DefaultExecTimeout = 30 * time.Second
+    // Setting it to anything disables exec sources, ie in locked-down images
+    NoExecEnvVar       = "GOTILLER_NO_EXEC"
+)
+
+var execSourcesEnabled = os.Getenv(NoExecEnvVar) == ""
+
+// Allow or forbid exec sources. With exec sources forbidden,
+// configs that have them fail.
+func EnableExecSources(enable bool) {
+    execSourcesEnabled = enable
+}
+
+// A command to run. Command given as a string is run with sh -c, it gets
+// environment and hostname in GOTILLER_ENVIRONMENT and GOTILLER_HOSTNAME
+// env vars only. Args given as a list can contain {{environment}} and
+// {{hostname}}, they are replaced verbatim.
+type ExecCommand struct {
+    Args     []string
+    Shell    bool
+    Format   string
+    Timeout  time.Duration
+    Optional bool
+}
+func MakeExecCommand(c interface{}) *ExecCommand {
+    ec := ExecCommand{Format: "json", Timeout: DefaultExecTimeout}
+
+    c_m, is_map := c.(util.AnyMap)
+    if !is_map {
+        c_m = util.AnyMap{"command": c}
+    }
+    switch cmd := c_m["command"].(type) {
+        case string:
+            ec.Args = []string{"/bin/sh", "-c", cmd}
+            ec.Shell = true
+        case []interface{}:
+            ec.Args = util.ToStrings(cmd)
+    }
+    if len(ec.Args) == 0 {
+        logger.Panicf("Invalid exec_vars command %v", c)
+    }
+    if v, exists := c_m["format"]; exists {
+        ec.Format = util.ToString(v)
+    }
+    if v, exists := c_m["timeout"]; exists {
+        ec.Timeout = util.ToDuration(v)
+    }
+    ec.Optional, _ = c_m["optional"].(bool)
+    return &ec
+}
+
+// Runs the command, returns parsed stdout
+func (ec *ExecCommand) Run(environment string) (util.AnyMap, string) {
+    hostname := util.Hostname()
+    args := ec.Args
+    // Never expanded into shell code
+    if !ec.Shell {
+        r := strings.NewReplacer("{{environment}}", environment, "{{hostname}}", hostname)
+        args = nil
+        for _, a := range ec.Args {
+            args = append(args, r.Replace(a))
+        }
+    }
+    cmd_s := strings.Join(args, " ")
+
+    env := []string{"GOTILLER_ENVIRONMENT=" + environment, "GOTILLER_HOSTNAME=" + hostname}
+    logger.Debugf("Running %s\n", cmd_s)
+    stdout, stderr, err := util.RunCommand(args, env, ec.Timeout)
+    if err != nil {
+        if ec.Optional {
+            logger.Printf("Optional exec_vars %s failed: %s %s\n", cmd_s, err, stderr)
+            return nil, cmd_s
+        }
+        logger.Panicf("exec_vars %s failed: %s %s", cmd_s, err, stderr)
+    }
+
+    return ParseVars(stdout, ec.Format, cmd_s), cmd_s
+}
+
+// exec_vars Source. Commands are run per environment, when needed,
+// later commands' vars trumping earlier ones'.
+type ExecVarsSource struct {
+    Commands []*ExecCommand
+
+    EnvironmentDeployables
+    BaseSource
+}
+// Config is a command, or a list of commands. Command is a string, or a map
+// with command (a string or a list of args), format, timeout and optional keys.
+func (e *ExecVarsSource) MergeConfig(origin string, c interface{}) {
+    if !execSourcesEnabled {
+        logger.Panicf("%s: exec_vars sources are disabled", origin)
+    }
+    e.AddHistory(origin, c)
+
+    if cmds, is_list := c.([]interface{}); is_list {
+        for _, cmd := range cmds {
+            e.Commands = append(e.Commands, MakeExecCommand(cmd))
+        }
+    } else {
+        e.Commands = append(e.Commands, MakeExecCommand(c))
+    }
+}
+
+func (e *ExecVarsSource) DeployablesForEnvironment(environment string) *Deployables {
+    if len(e.Commands) == 0 {
+        return nil
+    }
+    if d, exists := e.EnvironmentDeployables[environment]; exists {
+        return d
+    }
+
+    var d *Deployables
+    for _, cmd := range e.Commands {
+        vars, cmd_s := cmd.Run(environment)
+        if vars == nil {
+            continue
+        }
+        e.AddHistory("exec_vars " + cmd_s, vars)
+
+        cmd_d := MakeDeployables(AsDeployablesMap(vars))
+        if d == nil {
+            d = cmd_d
+        } else {
+            d.Merge(cmd_d)
+        }
+    }
+
+    e.EnvironmentDeployables[environment] = d
+    return d
+}
+
+func MakeExecVarsSource() SourceInterface {
+    return &ExecVarsSource{nil, make(EnvironmentDeployables), MakeBaseSource()}
+}
+
+func init() {
+    RegisterSource("exec_vars", MakeExecVarsSource, 77, false)
+}
@@ -0,0 +1,46 @@
+package sources
+
+import (
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+func Test_ExecVarsSource(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    es := MakeExecVarsSource()
+    es.MergeConfig("test", []interface{}{
+        `echo '{"a": "json", "env": "'$GOTILLER_ENVIRONMENT'", "db": {"host": "dbhost"}}'`,
+        util.AnyMap{"command": []interface{}{"echo", "b: {{environment}}"}, "format": "yaml"},
+        util.AnyMap{"command": "printf 'a=env\\nc=3\\n'", "format": "env"},
+        util.AnyMap{"command": "exit 1", "optional": true},
+        `echo '{"shell": "{{environment}}"}'`,
+    })
+
+    d := es.DeployablesForEnvironment("prod")
+    assert.Equal(t, Vars{"a": "env", "env": "prod", "db.host": "dbhost", "b": "prod", "c": "3", "shell": "{{environment}}"}, d.Vars, "exec_vars vars")
+    var origins []string
+    for _, e := range es.(*ExecVarsSource).MergeHistory {
+        origins = append(origins, e.Origin)
+    }
+    assert.Contains(t, origins, "exec_vars echo b: prod", "exec_vars provenance")
+
+    // Environment is never expanded into shell code
+    es = MakeExecVarsSource()
+    es.MergeConfig("test", `printf '{"env": "%s"}' "$GOTILLER_ENVIRONMENT"`)
+    d = es.DeployablesForEnvironment("'; touch injected; '")
+    assert.Equal(t, Vars{"env": "'; touch injected; '"}, d.Vars, "environment in env var only")
+
+    es = MakeExecVarsSource()
+    es.MergeConfig("test", util.AnyMap{"command": "sleep 5", "timeout": "10ms"})
+    assert.Panics(t, func() { es.DeployablesForEnvironment("prod") }, "exec_vars timeout")
+
+    es = MakeExecVarsSource()
+    es.MergeConfig("test", "echo not json")
+    assert.Panics(t, func() { es.DeployablesForEnvironment("prod") }, "exec_vars invalid output")
+
+    EnableExecSources(false)
+    defer EnableExecSources(true)
+    assert.Panics(t, func() { MakeExecVarsSource().MergeConfig("test", "true") }, "exec_vars disabled")
+}
@@ -52,7 +52,7 @@ func (f *FileSystemSource) MergeConfig(origin string, d interface{}) {
         for _, entry := range dir_entries {
             t := entry.Name()
 
-            f.Templates[t] = &Template{filepath.Join(template_dir_path, t), ""}
+            f.Templates[t] = &Template{Path: filepath.Join(template_dir_path, t)}
         }
     }
 }
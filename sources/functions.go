@@ -0,0 +1,151 @@
+// Standard functions library available to templates.
+// Mostly Sprig compatible names and argument order.
+
+package sources
+
+import (
+    "github.com/catalyst/gotiller/util"
+)
+
+var StandardFuncs = map[string]interface{}{
+    // Strings
+    "upper"           : util.Upper,
+    "lower"           : util.Lower,
+    "title"           : util.Title,
+    "trim"            : util.Trim,
+    "trimAll"         : util.TrimAll,
+    "trimPrefix"      : util.TrimPrefix,
+    "trimSuffix"      : util.TrimSuffix,
+    "nospace"         : util.NoSpace,
+    "contains"        : util.Contains,
+    "hasPrefix"       : util.HasPrefix,
+    "hasSuffix"       : util.HasSuffix,
+    "repeat"          : util.Repeat,
+    "replace"         : util.Replace,
+    "substr"          : util.Substr,
+    "trunc"           : util.Trunc,
+    "quote"           : util.Quote,
+    "squote"          : util.SQuote,
+    "cat"             : util.Cat,
+    "indent"          : util.Indent,
+    "nindent"         : util.NIndent,
+    "split"           : util.Split,
+    "splitList"       : util.SplitList,
+    "join"            : util.Join,
+    "sortAlpha"       : util.SortAlpha,
+    "regexMatch"      : util.RegexMatch,
+    "regexFind"       : util.RegexFind,
+    "regexFindAll"    : util.RegexFindAll,
+    "regexReplaceAll" : util.RegexReplaceAll,
+    "regexSplit"      : util.RegexSplit,
+
+    // Defaults and conversions
+    "default"         : util.Default,
+    "empty"           : util.IsEmpty,
+    "ternary"         : util.Ternary,
+    "toString"        : util.ToString,
+    "toStrings"       : util.ToStrings,
+    "int"             : util.ToInt64,
+    "float64"         : util.ToFloat64,
+
+    // Math
+    "add"             : util.Add,
+    "add1"            : util.Add1,
+    "sub"             : util.Sub,
+    "mul"             : util.Mul,
+    "div"             : util.Div,
+    "mod"             : util.Mod,
+    "max"             : util.Max,
+    "min"             : util.Min,
+    "floor"           : util.Floor,
+    "ceil"            : util.Ceil,
+    "round"           : util.Round,
+
+    // Encodings
+    "b64enc"          : util.B64Enc,
+    "b64dec"          : util.B64Dec,
+    "sha1sum"         : util.Sha1Sum,
+    "sha256sum"       : util.Sha256Sum,
+    "sha512sum"       : util.Sha512Sum,
+    "adler32sum"      : util.Adler32Sum,
+    "toJson"          : util.ToJson,
+    "toPrettyJson"    : util.ToPrettyJson,
+    "fromJson"        : util.FromJson,
+    "toYaml"          : util.ToYaml,
+    "fromYaml"        : util.FromYaml,
+
+    // Structured data
+    "toToml"          : util.ToToml,
+    "toIni"           : util.ToIni,
+    "toShell"         : util.ToShell,
+    "shellQuote"      : util.ShellQuote,
+    "typed"           : util.Typed,
+
+    // Lists
+    "list"            : util.List,
+    "first"           : util.First,
+    "last"            : util.Last,
+    "rest"            : util.Rest,
+    "initial"         : util.Initial,
+    "append"          : util.Append,
+    "prepend"         : util.Prepend,
+    "concat"          : util.Concat,
+    "reverse"         : util.Reverse,
+    "uniq"            : util.Uniq,
+    "compact"         : util.Compact,
+    "without"         : util.Without,
+    "has"             : util.Has,
+
+    // Dicts
+    "dict"            : util.Dict,
+    "get"             : util.Get,
+    "set"             : util.Set,
+    "unset"           : util.Unset,
+    "hasKey"          : util.HasKey,
+    "keys"            : util.Keys,
+    "values"          : util.Values,
+    "pick"            : util.Pick,
+    "omit"            : util.Omit,
+    "merge"           : util.Merge,
+
+    // Dates
+    "now"             : util.Now,
+    "date"            : util.Date,
+    "dateInZone"      : util.DateInZone,
+    "dateModify"      : util.DateModify,
+    "unixEpoch"       : util.UnixEpoch,
+    "toDate"          : util.ToDate,
+}
+
+// Functions that depend on the host the templates are processed on.
+// They can be disabled for reproducible processing, see
+// Processor.NoHostFunctions.
+var HostFuncs = map[string]interface{}{
+    "hostname"   : util.Hostname,
+    "fqdn"       : util.Fqdn,
+    "interfaces" : util.Interfaces,
+    "ipv4"       : util.IPv4,
+    "ipv4s"      : util.IPv4s,
+    "ipv6"       : util.IPv6,
+    "ipv6s"      : util.IPv6s,
+    "numcpu"     : util.NumCPU,
+    "memtotal"   : util.MemTotal,
+    "lookupHost" : util.LookupHost,
+}
+func init() {
+    for name, fn := range HostFuncs {
+        RegisterTemplateFunc(name, fn)
+    }
+
+    // No readable dirs by default, Processor supplies its own
+    for name, fn := range util.ReadableDirs(nil).FuncMap() {
+        RegisterTemplateFunc(name, fn)
+    }
+
+    for name, fn := range StandardFuncs {
+        if _, exists := FuncMap[name]; exists {
+            continue  // keep the original semantics
+        }
+        RegisterTemplateFunc(name, fn)
+    }
+}
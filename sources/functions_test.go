@@ -0,0 +1,251 @@
+package sources
+
+import (
+    "os"
+    "fmt"
+    "runtime"
+    "path/filepath"
+    "strings"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+var standard_function_tests = map[string]struct{
+    template string
+    vars     Vars
+    out      string
+}{
+    "upper":           {`{{upper .a}}`,                            Vars{"a": "aBc"},      `ABC`},
+    "upper_nil":       {`{{upper .nonexist}}`,                     nil,                   ``},
+    "lower":           {`{{.a | lower}}`,                          Vars{"a": "aBc"},      `abc`},
+    "title":           {`{{title "hello  world"}}`,                nil,                   `Hello  World`},
+    "title_unicode":   {`{{title "élan vital\tx"}}`,               nil,                   "Élan Vital\tX"},
+    "trim":            {`[{{trim "  x y  "}}]`,                    nil,                   `[x y]`},
+    "trimAll":         {`{{trimAll "$" "$5.00$"}}`,                nil,                   `5.00`},
+    "trimPrefix":      {`{{trimPrefix "-" "-x-"}}`,                nil,                   `x-`},
+    "trimSuffix":      {`{{trimSuffix "-" "-x-"}}`,                nil,                   `-x`},
+    "nospace":         {`{{nospace " a b\tc "}}`,                  nil,                   `abc`},
+    "contains":        {`{{contains "ell" "hello"}}`,              nil,                   `true`},
+    "hasPrefix":       {`{{hasPrefix "he" "hello"}}`,              nil,                   `true`},
+    "hasSuffix":       {`{{hasSuffix "he" "hello"}}`,              nil,                   `false`},
+    "repeat":          {`{{repeat 3 "ab"}}`,                       nil,                   `ababab`},
+    "replace":         {`{{"a.b.c" | replace "." "/"}}`,           nil,                   `a/b/c`},
+    "substr":          {`{{substr 1 3 "hello"}}`,                  nil,                   `el`},
+    "trunc":           {`{{trunc 2 "hello"}} {{trunc -2 "hello"}}`, nil,                  `he lo`},
+    "quote":           {`{{quote .a "b"}}`,                        Vars{"a": `x"y`},      `"x\"y" "b"`},
+    "squote":          {`{{squote "a"}}`,                          nil,                   `'a'`},
+    "cat":             {`{{cat "a" .nonexist "b"}}`,               nil,                   `a b`},
+    "indent":          {`{{indent 2 "a\nb"}}`,                     nil,                   "  a\n  b"},
+    "nindent":         {`x:{{nindent 2 "a\nb"}}`,                  nil,                   "x:\n  a\n  b"},
+    "split":           {`{{$p := split "," "a,b"}}{{$p._1}}`,      nil,                   `b`},
+    "splitList":       {`{{range splitList "," "a,b"}}[{{.}}]{{end}}`, nil,               `[a][b]`},
+    "join":            {`{{join "-" (splitList "," .a)}}`,         Vars{"a": "x,y,z"},    `x-y-z`},
+    "sortAlpha":       {`{{sortAlpha (list "c" "a" "b") | join ","}}`, nil,               `a,b,c`},
+    "regexMatch":      {`{{regexMatch "^\\d+$" "123"}}`,           nil,                   `true`},
+    "regexFind":       {`{{regexFind "\\d+" "ab12cd34"}}`,         nil,                   `12`},
+    "regexFindAll":    {`{{regexFindAll "\\d+" -1 "ab12cd34" | join ","}}`, nil,          `12,34`},
+    "regexReplaceAll": {`{{regexReplaceAll "(\\d)" "a1b2" "<$1>"}}`, nil,                 `a<1>b<2>`},
+    "regexSplit":      {`{{regexSplit "\\s*,\\s*" -1 "a , b,c" | join "|"}}`, nil,        `a|b|c`},
+
+    "default":         {`{{.nonexist | default "dflt"}} {{.a | default "dflt"}}`, Vars{"a": "x"}, `dflt x`},
+    "default_empty":   {`{{.a | default "dflt"}}`,                 Vars{"a": ""},         `dflt`},
+    "empty":           {`{{empty .nonexist}} {{empty "x"}}`,       nil,                   `true false`},
+    "ternary":         {`{{ternary "yes" "no" (eq .a "1")}}`,      Vars{"a": "1"},        `yes`},
+    "toString":        {`{{toString 5}}`,                          nil,                   `5`},
+    "toStrings":       {`{{toStrings (list 1 2) | join ","}}`,     nil,                   `1,2`},
+    "int":             {`{{add (int .a) 1}}`,                      Vars{"a": "41"},       `42`},
+    "float64":         {`{{float64 "1.5"}}`,                       nil,                   `1.5`},
+
+    "add":             {`{{add .a 2 3}}`,                          Vars{"a": "1"},        `6`},
+    "add1":            {`{{add1 .a}}`,                             Vars{"a": "1"},        `2`},
+    "sub":             {`{{sub 5 .a}}`,                            Vars{"a": "2"},        `3`},
+    "mul":             {`{{mul .a 2 3}}`,                          Vars{"a": "2"},        `12`},
+    "div":             {`{{div 7 2}}`,                             nil,                   `3`},
+    "mod":             {`{{mod 7 2}}`,                             nil,                   `1`},
+    "max":             {`{{max 1 .a 3}}`,                          Vars{"a": "7"},        `7`},
+    "min":             {`{{min 1 .a 3}}`,                          Vars{"a": "-7"},       `-7`},
+    "floor":           {`{{floor "1.7"}}`,                         nil,                   `1`},
+    "ceil":            {`{{ceil "1.2"}}`,                          nil,                   `2`},
+    "round":           {`{{round "1.256" 2}}`,                     nil,                   `1.26`},
+
+    "b64enc":          {`{{b64enc "hello"}}`,                      nil,                   `aGVsbG8=`},
+    "b64dec":          {`{{b64dec "aGVsbG8="}}`,                   nil,                   `hello`},
+    "sha1sum":         {`{{sha1sum "hello"}}`,                     nil,                   `aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d`},
+    "sha256sum":       {`{{sha256sum "hello"}}`,                   nil,                   `2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824`},
+    "sha512sum":       {`{{sha512sum "" | trunc 16}}`,             nil,                   `cf83e1357eefb8bd`},
+    "adler32sum":      {`{{adler32sum "hello"}}`,                  nil,                   `103547413`},
+    "toJson":          {`{{toJson (dict "a" "<b>" "n" 1)}}`,       nil,                   `{"a":"<b>","n":1}`},
+    "toJson_vars":     {`{{toJson .}}`,                            Vars{"a": "x"},        `{"a":"x"}`},
+    "toPrettyJson":    {`{{toPrettyJson (list 1)}}`,               nil,                   "[\n  1\n]"},
+    "fromJson":        {`{{(fromJson .a).k}}`,                     Vars{"a": `{"k":"v"}`}, `v`},
+    "toYaml":          {`{{toYaml (dict "a" (list 1 2))}}`,        nil,                   "a:\n    - 1\n    - 2"},
+    "fromYaml":        {`{{(fromYaml .a).k}}`,                     Vars{"a": "k: v"},     `v`},
+
+    "toToml":          {`{{toToml (dict "a" "x\"y" "n" 1 "t" (dict "l" (list 1 "b")))}}`, nil, "a = \"x\\\"y\"\nn = 1\n\n[t]\nl = [1, \"b\"]\n"},
+    "toIni":           {`{{toIni (dict "a" "x" "s" (dict "b" "has;semicolon"))}}`, nil,  "a = x\n\n[s]\nb = \"has;semicolon\"\n"},
+    "toShell":         {`{{toShell (dict "A" "$x" "db" (dict "host-name" "h"))}}`, nil,  "A=\"\\$x\"\ndb_host_name=\"h\"\n"},
+    "shellQuote":      {`{{shellQuote "a\"b"}}`,                  nil,                   `"a\"b"`},
+    "typed":           {`{{toJson (typed (dict "b" "true" "n" "10" "z" "010"))}}`, nil,   `{"b":true,"n":10,"z":"010"}`},
+
+    "list":            {`{{range list 1 "a"}}[{{.}}]{{end}}`,      nil,                   `[1][a]`},
+    "first":           {`{{first (list 1 2 3)}}`,                  nil,                   `1`},
+    "last":            {`{{last (list 1 2 3)}}`,                   nil,                   `3`},
+    "rest":            {`{{rest (list 1 2 3) | join ","}}`,        nil,                   `2,3`},
+    "initial":         {`{{initial (list 1 2 3) | join ","}}`,     nil,                   `1,2`},
+    "append":          {`{{append (list 1 2) 3 | join ","}}`,      nil,                   `1,2,3`},
+    "prepend":         {`{{prepend (list 1 2) 0 | join ","}}`,     nil,                   `0,1,2`},
+    "concat":          {`{{concat (list 1) (list 2 3) | join ","}}`, nil,                 `1,2,3`},
+    "reverse":         {`{{reverse (list 1 2 3) | join ","}}`,     nil,                   `3,2,1`},
+    "uniq":            {`{{uniq (list 1 2 1 2) | join ","}}`,      nil,                   `1,2`},
+    "compact":         {`{{compact (list 1 "" 2) | join ","}}`,    nil,                   `1,2`},
+    "without":         {`{{without (list 1 2 3) 2 | join ","}}`,   nil,                   `1,3`},
+    "has":             {`{{has "b" (splitList "," "a,b")}} {{has "c" (splitList "," "a,b")}}`, nil, `true false`},
+
+    "dict":            {`{{$d := dict "a" 1 "b" 2}}{{$d.a}}{{$d.b}}`, nil,                `12`},
+    "get":             {`{{get (dict "a" 1) "a"}}`,                nil,                   `1`},
+    "set":             {`{{$d := dict}}{{$_ := set $d "a" 1}}{{$d.a}}`, nil,              `1`},
+    "unset":           {`{{$d := dict "a" 1}}{{$_ := unset $d "a"}}{{hasKey $d "a"}}`, nil, `false`},
+    "hasKey":          {`{{hasKey . "a"}} {{hasKey . "b"}}`,       Vars{"a": ""},         `true false`},
+    "keys":            {`{{keys (dict "b" 1 "a" 2) | join ","}}`,  nil,                   `a,b`},
+    "values":          {`{{values (dict "b" 1 "a" 2) | join ","}}`, nil,                  `2,1`},
+    "pick":            {`{{keys (pick (dict "a" 1 "b" 2) "a") | join ","}}`, nil,        `a`},
+    "omit":            {`{{keys (omit (dict "a" 1 "b" 2) "a") | join ","}}`, nil,        `b`},
+    "merge":           {`{{$d := merge (dict "a" 1) (dict "a" 2 "b" 3)}}{{$d.a}}{{$d.b}}`, nil, `13`},
+
+    "now":             {`{{gt (unixEpoch now) "1600000000"}}`,     nil,                   `true`},
+    "date":            {`{{date "2006" now | len}}`,               nil,                   `4`},
+    "dateInZone":      {`{{dateInZone "2006-01-02 15:04" 0 "UTC"}}`, nil,                 `1970-01-01 00:00`},
+    "dateModify":      {`{{dateInZone "15:04" (dateModify "90m" 0) "UTC"}}`, nil,        `01:30`},
+    "unixEpoch":       {`{{unixEpoch .a}}`,                        Vars{"a": "1234"},     `1234`},
+    "toDate":          {`{{toDate "2006-01-02" "2020-02-03" | date "01/02/2006"}}`, nil, `02/03/2020`},
+}
+func Test_standard_functions(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    for fn := range StandardFuncs {
+        _, exists := standard_function_tests[fn]
+        assert.True(t, exists, fn + " function test")
+    }
+
+    for fn, test := range standard_function_tests {
+        out := new(strings.Builder)
+        template := &Template{Content: test.template}
+
+        template.Write(out, test.vars)
+        assert.Equal(t, test.out, out.String(), fn + " function")
+    }
+}
+
+func Test_host_functions(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    hostname, _ := os.Hostname()
+    host_function_tests := map[string]struct{
+        template string
+        out      string
+    }{
+        "hostname":   {`{{hostname}}`,                                 hostname},
+        "fqdn":       {`{{if fqdn}}ok{{end}}`,                         `ok`},
+        "interfaces": {`{{has "lo" (interfaces)}}`,                    `true`},
+        "ipv4":       {`{{ipv4 "lo"}}`,                                `127.0.0.1`},
+        "ipv4s":      {`{{first (ipv4s "lo")}}`,                       `127.0.0.1`},
+        "ipv6":       {`{{$ip := ipv6 "lo"}}{{if $ip}}{{eq $ip "::1"}}{{else}}true{{end}}`, `true`},
+        "ipv6s":      {`{{len (ipv6s "lo") | le 0}}`,                  `true`},
+        "numcpu":     {`{{numcpu}}`,                                   fmt.Sprint(runtime.NumCPU())},
+        "memtotal":   {`{{gt memtotal 0}}`,                            `true`},
+        "lookupHost": {`{{has "127.0.0.1" (lookupHost "localhost")}}`, `true`},
+    }
+
+    for fn := range HostFuncs {
+        _, exists := host_function_tests[fn]
+        assert.True(t, exists, fn + " function test")
+    }
+
+    for fn, test := range host_function_tests {
+        out := new(strings.Builder)
+        template := &Template{Content: test.template}
+
+        template.Write(out, nil)
+        assert.Equal(t, test.out, out.String(), fn + " function")
+    }
+}
+
+func Test_NoHostFunctions(t *testing.T) {
+    template := &Template{Content: `{{hostname}}`, NoHostFuncs: true}
+    assert.Panics(t, func() { template.Write(new(strings.Builder), nil) }, "disabled hostname function")
+
+    dir := t.TempDir()
+    util.Mkdir(filepath.Join(dir, TemplatesSubdir))
+    util.WriteFile(filepath.Join(dir, TemplatesSubdir, "host"), []byte(`{{hostname}}`))
+
+    p := LoadConfigsFromDir(dir)
+    p.NoHostFunctions = true
+    assert.Panics(t, func() { p.Template("host").Write(new(strings.Builder), nil) }, "processor disabled hostname function")
+
+    hostname, _ := os.Hostname()
+    out := new(strings.Builder)
+    LoadConfigsFromDir(dir).Template("host").Write(out, nil)
+    assert.Equal(t, hostname, out.String(), "other processors keep host functions")
+}
+
+func Test_file_functions(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    dir := t.TempDir()
+    secrets_dir := filepath.Join(dir, "secrets")
+    util.Mkdir(secrets_dir)
+    util.WriteFile(filepath.Join(secrets_dir, "password"), []byte("secret\n"))
+    util.WriteFile(filepath.Join(secrets_dir, "lines"), []byte("a\nb\n"))
+    util.WriteFile(filepath.Join(secrets_dir, "c.json"), []byte(`{"k": "json"}`))
+    util.WriteFile(filepath.Join(secrets_dir, "c.yaml"), []byte(`k: yaml`))
+    util.WriteFile(filepath.Join(dir, "outside"), []byte("outside"))
+    if err := os.Symlink(filepath.Join(dir, "outside"), filepath.Join(secrets_dir, "link")); err != nil {
+        panic(err)
+    }
+
+    p := NewProcessor()
+    p.MergeConfig("test", util.AnyMap{"readable_dirs": []interface{}{secrets_dir}})
+    funcs := p.ReadableDirs.FuncMap()
+
+    file_function_tests := map[string]struct{
+        template string
+        out      string
+    }{
+        "readfile":  {`{{readfile .password | trim}}`,                    `secret`},
+        "readlines": {`{{readlines .lines | join ","}}`,                  `a,b`},
+        "readjson":  {`{{(readjson .c_json).k}}`,                         `json`},
+        "readyaml":  {`{{(readyaml .c_yaml).k}}`,                         `yaml`},
+        "glob":      {`{{range glob .pattern}}{{base .}} {{end}}`,        `c.json c.yaml `},
+    }
+    vars := Vars{
+        "password": filepath.Join(secrets_dir, "password"),
+        "lines":    filepath.Join(secrets_dir, "lines"),
+        "c_json":   filepath.Join(secrets_dir, "c.json"),
+        "c_yaml":   filepath.Join(secrets_dir, "c.yaml"),
+        "pattern":  filepath.Join(dir, "*", "c.*"),
+    }
+
+    for fn := range funcs {
+        _, exists := file_function_tests[fn]
+        assert.True(t, exists, fn + " function test")
+    }
+    funcs["base"] = filepath.Base
+
+    for fn, test := range file_function_tests {
+        out := new(strings.Builder)
+        template := &Template{Content: test.template, Funcs: funcs}
+
+        template.Write(out, vars)
+        assert.Equal(t, test.out, out.String(), fn + " function")
+    }
+
+    for _, path := range []string{filepath.Join(dir, "outside"), filepath.Join(secrets_dir, "link"), filepath.Join(secrets_dir, "..", "outside")} {
+        template := &Template{Content: `{{readfile .path}}`, Funcs: funcs}
+        assert.Panics(t, func() { template.Write(new(strings.Builder), Vars{"path": path}) }, "readfile " + path)
+    }
+
+    template := &Template{Content: `{{readfile .password}}`}
+    assert.Panics(t, func() { template.Write(new(strings.Builder), vars) }, "readfile with no readable dirs")
+}
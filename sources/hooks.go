@@ -0,0 +1,182 @@
+// Deploy hooks - commands run after targets change
+
+package sources
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const DefaultHookTimeout = 30 * time.Second
+
+// A hook command. Command given as a string is run with sh -c.
+type Hook struct {
+    Args    []string
+    Timeout time.Duration
+}
+func MakeHook(c interface{}) *Hook {
+    h := Hook{Timeout: DefaultHookTimeout}
+
+    c_m, is_map := c.(util.AnyMap)
+    if !is_map {
+        c_m = util.AnyMap{"command": c}
+    }
+    switch cmd := c_m["command"].(type) {
+        case string:
+            h.Args = []string{"/bin/sh", "-c", cmd}
+        case []interface{}:
+            h.Args = util.ToStrings(cmd)
+    }
+    if len(h.Args) == 0 {
+        logger.Panicf("Invalid hook command %v", c)
+    }
+    if v, exists := c_m["timeout"]; exists {
+        h.Timeout = util.ToDuration(v)
+    }
+    return &h
+}
+// Hooks config is a hook, or a list of hooks. Hook is a string, or a map
+// with command (a string or a list of args) and timeout keys.
+func MakeHooks(c interface{}) []*Hook {
+    var hooks []*Hook
+    if c_l, is_list := c.([]interface{}); is_list {
+        for _, h := range c_l {
+            hooks = append(hooks, MakeHook(h))
+        }
+    } else {
+        hooks = append(hooks, MakeHook(c))
+    }
+    return hooks
+}
+
+func (h *Hook) String() string {
+    if len(h.Args) == 3 && h.Args[0] == "/bin/sh" && h.Args[1] == "-c" {
+        return h.Args[2]
+    }
+    return strings.Join(h.Args, " ")
+}
+
+// Runs the hook, env is added to the inherited environment.
+// Returns an error with the hook output on failure.
+func (h *Hook) Run(env []string) error {
+    logger.Printf("Running hook %s\n", h)
+    stdout, stderr, err := util.RunCommand(h.Args, env, h.Timeout)
+    if len(stdout) > 0 {
+        logger.Debugf("Hook %s output: %s\n", h, stdout)
+    }
+    if err != nil {
+        return fmt.Errorf("Hook %s failed: %s %s", h, err, strings.TrimSpace(string(stderr)))
+    }
+    return nil
+}
+
+// What happened to a Spec's target
+type DeployResult struct {
+    Name            string
+    Target          string
+    ContentChanged  bool
+    MetadataChanged bool
+}
+func (r *DeployResult) Changed() bool {
+    return r.ContentChanged || r.MetadataChanged
+}
+// Env vars describing the target, for hooks
+func (r *DeployResult) HookEnv(environment string) []string {
+    return []string{
+        "GOTILLER_ENVIRONMENT=" + environment,
+        "GOTILLER_TEMPLATE=" + r.Name,
+        "GOTILLER_TARGET=" + r.Target,
+        fmt.Sprintf("GOTILLER_CONTENT_CHANGED=%t", r.ContentChanged),
+        fmt.Sprintf("GOTILLER_METADATA_CHANGED=%t", r.MetadataChanged),
+    }
+}
+
+// Runs on_change hooks if the content changed, on_deploy hooks if anything changed.
+// Returns hook errors.
+func (s *Spec) RunHooks(r *DeployResult, environment string) []string {
+    var hooks []*Hook
+    if r.ContentChanged {
+        hooks = append(hooks, s.OnChange...)
+    }
+    if r.Changed() {
+        hooks = append(hooks, s.OnDeploy...)
+    }
+
+    var errs []string
+    for _, h := range hooks {
+        if err := h.Run(r.HookEnv(environment)); err != nil {
+            errs = append(errs, r.Name + ": " + err.Error())
+        }
+    }
+    return errs
+}
+
+// Processor run outcome.
+// Errors are deploy errors, HookErrors hook failures.
+// Skipped are disabled Specs and ones with false when, with the reason.
+type RunResult struct {
+    sync.Mutex
+    Environment string
+    Deployed    []*DeployResult
+    Skipped     []string
+    Errors      []string
+    HookErrors  []string
+}
+func (rr *RunResult) add(r *DeployResult, errs []string, hook_errs []string) {
+    rr.Lock()
+    defer rr.Unlock()
+
+    if r != nil {
+        rr.Deployed = append(rr.Deployed, r)
+    }
+    rr.Errors = append(rr.Errors, errs...)
+    rr.HookErrors = append(rr.HookErrors, hook_errs...)
+}
+func (rr *RunResult) skip(skipped string) {
+    rr.Lock()
+    defer rr.Unlock()
+
+    rr.Skipped = append(rr.Skipped, skipped)
+}
+func (rr *RunResult) sort() {
+    sort.Slice(rr.Deployed, func(i, j int) bool { return rr.Deployed[i].Name < rr.Deployed[j].Name })
+    sort.Strings(rr.Skipped)
+    sort.Strings(rr.Errors)
+    sort.Strings(rr.HookErrors)
+}
+// Targets that changed
+func (rr *RunResult) ChangedTargets() []string {
+    var targets []string
+    for _, r := range rr.Deployed {
+        if r.Changed() {
+            targets = append(targets, r.Target)
+        }
+    }
+    return targets
+}
+func (rr *RunResult) Failed() bool {
+    return len(rr.Errors) > 0 || len(rr.HookErrors) > 0
+}
+
+// Runs after_run hooks if any target changed
+func (p *Processor) runAfterRunHooks(rr *RunResult) {
+    changed := rr.ChangedTargets()
+    if len(changed) == 0 {
+        return
+    }
+
+    env := []string{
+        "GOTILLER_ENVIRONMENT=" + rr.Environment,
+        "GOTILLER_CHANGED_TARGETS=" + strings.Join(changed, " "),
+    }
+    for _, h := range p.AfterRun {
+        if err := h.Run(env); err != nil {
+            rr.HookErrors = append(rr.HookErrors, "after_run: " + err.Error())
+        }
+    }
+}
@@ -0,0 +1,78 @@
+package sources
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+func Test_Hooks(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    dir := t.TempDir()
+    hooks_log := filepath.Join(dir, "hooks.log")
+    read_log := func() []string {
+        if !util.IsFile(hooks_log) {
+            return nil
+        }
+        lines := util.SlurpFileAsLines(hooks_log)
+        os.Remove(hooks_log)
+        return lines
+    }
+
+    p := NewProcessor()
+    p.MergeConfig("test", util.AnyMap{
+        "defaults": util.AnyMap{
+            "t1.json": util.AnyMap{
+                "target": "t1.json",
+                "format": "json",
+                "vars": util.AnyMap{"a": "1"},
+                "on_change": "echo change $GOTILLER_TEMPLATE $GOTILLER_ENVIRONMENT >> " + hooks_log,
+                "on_deploy": []interface{}{
+                    util.AnyMap{"command": []interface{}{"sh", "-c", "echo deploy $GOTILLER_CONTENT_CHANGED $GOTILLER_METADATA_CHANGED >> " + hooks_log}},
+                },
+            },
+            "t2.json": util.AnyMap{
+                "target": "t2.json",
+                "format": "json",
+                "on_change": "echo failed; exit 3",
+            },
+        },
+        "after_run": util.AnyMap{
+            "command": "echo after_run $GOTILLER_CHANGED_TARGETS >> " + hooks_log,
+            "timeout": "5s",
+        },
+    })
+
+    result := p.RunForEnvironment("prod", dir)
+    assert.Equal(t, []string{
+        "change t1.json prod",
+        "deploy true false",
+        "after_run " + filepath.Join(dir, "t1.json") + " " + filepath.Join(dir, "t2.json"),
+    }, read_log(), "hooks on first run")
+    assert.Equal(t, 1, len(result.HookErrors), "hook errors")
+    assert.True(t, strings.HasPrefix(result.HookErrors[0], "t2.json: Hook echo failed; exit 3 failed"), result.HookErrors[0])
+    assert.True(t, result.Failed(), "failed run")
+
+    result = p.RunForEnvironment("prod", dir)
+    assert.Nil(t, read_log(), "no hooks when nothing changed")
+    assert.Empty(t, result.ChangedTargets(), "nothing changed")
+    assert.False(t, result.Failed(), "successful run")
+
+    if err := os.Chmod(filepath.Join(dir, "t1.json"), 0600); err != nil {
+        panic(err)
+    }
+    p.MergeConfig("test", util.AnyMap{"defaults": util.AnyMap{"t1.json": util.AnyMap{"perms": 0644}}})
+    result = p.RunForEnvironment("prod", dir)
+    assert.Equal(t, []string{
+        "deploy false true",
+        "after_run " + filepath.Join(dir, "t1.json"),
+    }, read_log(), "hooks on metadata change")
+
+    hook := MakeHook(util.AnyMap{"command": "sleep 5", "timeout": "10ms"})
+    assert.Error(t, hook.Run(nil), "hook timeout")
+}
@@ -0,0 +1,191 @@
+// Infrastructure for fetching vars from JSON returning URLs
+
+package sources
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const DefaultHTTPVarsRetryDelay = time.Second
+
+// http_vars Source. URL is fetched per environment, when needed.
+// Select picks the part of the response that becomes vars.
+// OnError is fail (default) or cache - use the last good copy from CacheFile.
+type HTTPVarsSource struct {
+    URL        string
+    Headers    map[string]string
+    TokenFile  string
+    Select     string
+    Retries    int
+    RetryDelay time.Duration
+    OnError    string
+    CacheFile  string
+    HTTP       *util.HTTPClientConfig
+
+    EnvironmentDeployables
+    BaseSource
+}
+func (h *HTTPVarsSource) MergeConfig(origin string, c interface{}) {
+    c_m := c.(util.AnyMap)
+    h.AddHistory(origin, c_m)
+
+    fields := map[string]*string{
+        "url":        &h.URL,
+        "token_file": &h.TokenFile,
+        "select":     &h.Select,
+        "on_error":   &h.OnError,
+        "cache_file": &h.CacheFile,
+    }
+    for k, f := range fields {
+        if v, exists := c_m[k]; exists {
+            *f = util.ToString(v)
+        }
+    }
+    if headers, exists := c_m["headers"]; exists {
+        for n, v := range headers.(util.AnyMap) {
+            h.Headers[n] = util.ToString(v)
+        }
+    }
+    if v, exists := c_m["retries"]; exists {
+        h.Retries = v.(int)
+    }
+    if v, exists := c_m["retry_delay"]; exists {
+        h.RetryDelay = util.ToDuration(v)
+    }
+    h.HTTP.Merge(c_m)
+
+    switch h.OnError {
+        case "", "fail":
+        case "cache":
+            if h.CacheFile == "" {
+                logger.Panicf("%s: http_vars on_error cache needs cache_file", origin)
+            }
+        default:
+            logger.Panicf("%s: invalid http_vars on_error %s", origin, h.OnError)
+    }
+}
+
+// Fetches url, retrying on failures
+func (h *HTTPVarsSource) fetch(url string) (data interface{}, err error) {
+    headers := make(map[string]string)
+    for n, v := range h.Headers {
+        headers[n] = v
+    }
+    if h.TokenFile != "" {
+        headers["Authorization"] = "Bearer " + valueOrFile("", h.TokenFile)
+    }
+
+    client := h.HTTP.Client()
+    for attempt := 0; attempt <= h.Retries; attempt++ {
+        if attempt > 0 {
+            logger.Debugf("Retrying %s in %s: %s\n", url, h.RetryDelay, err)
+            time.Sleep(h.RetryDelay)
+        }
+        logger.Debugf("Fetching vars from %s\n", url)
+        if err = util.HTTPRequestJSON(client, "GET", url, headers, nil, &data); err == nil {
+            return
+        }
+    }
+    return
+}
+
+// Fetches url and selects vars from the response
+func (h *HTTPVarsSource) get(url string) (util.AnyMap, error) {
+    data, err := h.fetch(url)
+    if err != nil {
+        return nil, err
+    }
+    selected, err := util.SelectPath(data, h.Select)
+    if err != nil {
+        return nil, err
+    }
+    vars, ok := selected.(util.AnyMap)
+    if !ok {
+        return nil, fmt.Errorf("%s: selected %s is not a map", url, h.Select)
+    }
+    return vars, nil
+}
+
+// Saves the last good copy. Failures are logged, vars are good anyway.
+func writeHTTPVarsCache(path string, vars util.AnyMap) {
+    defer func() {
+        if r := recover(); r != nil {
+            logger.Printf("Cannot write http_vars cache %s: %v\n", path, r)
+        }
+    }()
+
+    content, err := json.Marshal(vars)
+    if err != nil {
+        panic(err)
+    }
+    util.Mkdir(filepath.Dir(path))
+    // May contain secrets
+    util.WriteFileAtomic(path, content, os.FileMode(0600))
+}
+
+// Reads the last good copy
+func readHTTPVarsCache(path string) util.AnyMap {
+    vars := make(util.AnyMap)
+    dec := json.NewDecoder(bytes.NewReader(util.SlurpFile(path)))
+    dec.UseNumber()
+    if err := dec.Decode(&vars); err != nil {
+        logger.Panicf("%s: %s", path, err)
+    }
+    return vars
+}
+
+func (h *HTTPVarsSource) DeployablesForEnvironment(environment string) *Deployables {
+    if h.URL == "" {
+        return nil
+    }
+    if d, exists := h.EnvironmentDeployables[environment]; exists {
+        return d
+    }
+
+    url := ExpandForEnvironment(h.URL, environment)
+    cache_file := ExpandForEnvironment(h.CacheFile, environment)
+
+    vars, err := h.get(url)
+
+    switch {
+        case err == nil:
+            h.AddHistory("http_vars " + url, vars)
+            if cache_file != "" {
+                writeHTTPVarsCache(cache_file, vars)
+            }
+        case h.OnError == "cache":
+            logger.Printf("http_vars %s failed, using cached %s: %s\n", url, cache_file, err)
+            if !util.IsFile(cache_file) {
+                logger.Panicf("http_vars %s failed and there is no cached %s: %s", url, cache_file, err)
+            }
+            vars = readHTTPVarsCache(cache_file)
+            h.AddHistory("http_vars cache " + cache_file, vars)
+        default:
+            panic(err)
+    }
+
+    d := MakeDeployables(AsDeployablesMap(vars))
+    h.EnvironmentDeployables[environment] = d
+    return d
+}
+
+func MakeHTTPVarsSource() SourceInterface {
+    return &HTTPVarsSource{
+        Headers:                make(map[string]string),
+        RetryDelay:             DefaultHTTPVarsRetryDelay,
+        HTTP:                   &util.HTTPClientConfig{},
+        EnvironmentDeployables: make(EnvironmentDeployables),
+        BaseSource:             MakeBaseSource(),
+    }
+}
+
+func init() {
+    RegisterSource("http_vars", MakeHTTPVarsSource, 75, false)
+}
@@ -0,0 +1,104 @@
+package sources
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+func Test_HTTPVarsSource(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    failures := 0
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") != "Bearer t0ken" || r.Header.Get("X-Team") != "ops" {
+            http.Error(w, "unauthorized", http.StatusUnauthorized)
+            return
+        }
+        if failures > 0 {
+            failures--
+            http.Error(w, "unavailable", http.StatusServiceUnavailable)
+            return
+        }
+        switch r.URL.Path {
+            case "/config/prod":
+                w.Write([]byte(`{"status": "ok", "data": {"items": [{"vars": {"port": 8080, "db": {"host": "dbhost"}}}]}}`))
+            case "/config/test":
+                w.Write([]byte(`{"status": "ok", "data": []}`))
+            case "/config/stage":
+                w.Write([]byte(`{"status": "ok", "data": {"items": [{"vars": "oops"}]}}`))
+            default:
+                http.NotFound(w, r)
+        }
+    }))
+    defer server.Close()
+
+    dir := t.TempDir()
+    token_file := filepath.Join(dir, "token")
+    util.WriteFile(token_file, []byte("t0ken\n"))
+
+    make_source := func(c util.AnyMap) SourceInterface {
+        hs := MakeHTTPVarsSource()
+        hs.MergeConfig("test", util.AnyMap{
+            "url": server.URL + "/config/{{environment}}",
+            "headers": util.AnyMap{"X-Team": "ops"},
+            "token_file": token_file,
+            "select": "$.data.items[0].vars",
+            "retries": 2,
+            "retry_delay": "1ms",
+            "cache_file": filepath.Join(dir, "{{environment}}.json"),
+        })
+        hs.MergeConfig("test", c)
+        return hs
+    }
+    expected := Vars{"port": "8080", "db.host": "dbhost"}
+
+    failures = 2
+    assert.Equal(t, expected, make_source(util.AnyMap{}).DeployablesForEnvironment("prod").Vars, "http_vars with retries")
+    assert.True(t, util.IsFile(filepath.Join(dir, "prod.json")), "http_vars cache file")
+
+    cache_file := filepath.Join(dir, "cache", "{{environment}}", "vars.json")
+    assert.Equal(t, expected, make_source(util.AnyMap{"cache_file": cache_file}).DeployablesForEnvironment("prod").Vars, "http_vars missing cache dir")
+    assert.True(t, util.IsFile(filepath.Join(dir, "cache", "prod", "vars.json")), "http_vars cache dir created")
+    // token_file is not a dir
+    bad_cache_file := filepath.Join(token_file, "vars.json")
+    assert.Equal(t, expected, make_source(util.AnyMap{"cache_file": bad_cache_file}).DeployablesForEnvironment("prod").Vars, "http_vars cache write failure")
+
+    failures = 3
+    assert.Panics(t, func() { make_source(util.AnyMap{}).DeployablesForEnvironment("prod") }, "http_vars retries exhausted")
+
+    failures = 3
+    hs := make_source(util.AnyMap{"on_error": "cache"})
+    assert.Equal(t, expected, hs.DeployablesForEnvironment("prod").Vars, "http_vars cached vars")
+
+    assert.Panics(t, func() { hs.DeployablesForEnvironment("test") }, "http_vars bad selection, no cache")
+
+    util.WriteFile(filepath.Join(dir, "stage.json"), []byte(`{"a": "cached"}`))
+    assert.Equal(t, Vars{"a": "cached"}, hs.DeployablesForEnvironment("stage").Vars, "http_vars selected not a map, cached vars")
+    assert.Panics(t, func() { make_source(util.AnyMap{}).DeployablesForEnvironment("stage") }, "http_vars selected not a map")
+    assert.Panics(t, func() { make_source(util.AnyMap{"on_error": "ignore"}) }, "http_vars invalid on_error")
+}
+
+func Test_SelectPath(t *testing.T) {
+    data := util.AnyMap{"a": util.AnyMap{"b": []interface{}{"x", util.AnyMap{"c": "y"}}}}
+
+    for path, expected := range map[string]interface{}{
+        "": data,
+        "$": data,
+        "$.a.b[0]": "x",
+        "a.b.1.c": "y",
+    } {
+        selected, err := util.SelectPath(data, path)
+        assert.NoError(t, err, path)
+        assert.Equal(t, expected, selected, path)
+    }
+
+    for _, path := range []string{"$.x", "a.b[2]", "a.b[0].c"} {
+        _, err := util.SelectPath(data, path)
+        assert.Error(t, err, path)
+    }
+}
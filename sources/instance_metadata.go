@@ -0,0 +1,209 @@
+// Infrastructure for cloud instance metadata, EC2 (IMDSv2) and GCE
+
+package sources
+
+import (
+    "fmt"
+    "net/http"
+    "path"
+    "strings"
+    "time"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const (
+    DefaultMetadataEndpoint = "http://169.254.169.254"
+    DefaultMetadataTimeout  = 2 * time.Second
+    DefaultMetadataPrefix   = "meta_"
+)
+
+// Vars every provider gives, "" if not available
+var InstanceMetadataVars = []string{
+    "provider",
+    "instance_id",
+    "instance_type",
+    "region",
+    "zone",
+    "private_ip",
+    "hostname",
+}
+
+type metadataFetcher func(client *http.Client, endpoint string) (map[string]string, error)
+
+func metadataGet(client *http.Client, url string, headers map[string]string) (string, error) {
+    body, err := util.HTTPRequest(client, "GET", url, headers, nil)
+    return strings.TrimSpace(string(body)), err
+}
+
+func metadataGetAll(client *http.Client, base string, paths map[string]string, headers map[string]string) (map[string]string, error) {
+    meta := make(map[string]string)
+    for n, p := range paths {
+        v, err := metadataGet(client, base + p, headers)
+        if err != nil {
+            return nil, err
+        }
+        meta[n] = v
+    }
+    return meta, nil
+}
+
+// EC2 IMDSv2: session token first, then metadata with the token
+func ec2Metadata(client *http.Client, endpoint string) (map[string]string, error) {
+    token, err := util.HTTPRequest(client, "PUT", endpoint + "/latest/api/token",
+        map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"}, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    meta, err := metadataGetAll(client, endpoint + "/latest/meta-data/", map[string]string{
+        "instance_id":   "instance-id",
+        "instance_type": "instance-type",
+        "region":        "placement/region",
+        "zone":          "placement/availability-zone",
+        "private_ip":    "local-ipv4",
+        "hostname":      "local-hostname",
+    }, map[string]string{"X-aws-ec2-metadata-token": string(token)})
+    if err != nil {
+        return nil, err
+    }
+    meta["provider"] = "ec2"
+    return meta, nil
+}
+
+// GCE: Metadata-Flavor header, zone and machine type are resource paths
+func gceMetadata(client *http.Client, endpoint string) (map[string]string, error) {
+    meta, err := metadataGetAll(client, endpoint + "/computeMetadata/v1/instance/", map[string]string{
+        "instance_id":   "id",
+        "instance_type": "machine-type",
+        "zone":          "zone",
+        "private_ip":    "network-interfaces/0/ip",
+        "hostname":      "hostname",
+    }, map[string]string{"Metadata-Flavor": "Google"})
+    if err != nil {
+        return nil, err
+    }
+
+    meta["instance_type"] = path.Base(meta["instance_type"])
+    meta["zone"] = path.Base(meta["zone"])
+    if i := strings.LastIndex(meta["zone"], "-"); i > 0 {
+        meta["region"] = meta["zone"][:i]
+    }
+    meta["provider"] = "gce"
+    return meta, nil
+}
+
+var metadataFetchers = map[string]metadataFetcher{
+    "ec2": ec2Metadata,
+    "gce": gceMetadata,
+}
+
+// instance_metadata Source. Metadata is fetched once, when needed.
+// Provider is ec2, gce or auto (default) - try them in turn.
+type InstanceMetadataSource struct {
+    Provider string
+    Endpoint string
+    Prefix   string
+    Optional bool
+    HTTP     *util.HTTPClientConfig
+
+    *Deployables
+    BaseSource
+}
+// Config is true, a provider name, or a map with provider, endpoint, prefix,
+// optional and HTTP options keys.
+func (m *InstanceMetadataSource) MergeConfig(origin string, c interface{}) {
+    m.AddHistory(origin, c)
+
+    switch c_t := c.(type) {
+        case bool:
+            if !c_t {
+                m.Provider = ""
+            } else if m.Provider == "" {
+                m.Provider = "auto"
+            }
+        case string:
+            m.Provider = c_t
+        case util.AnyMap:
+            if m.Provider == "" {
+                m.Provider = "auto"
+            }
+            fields := map[string]*string{
+                "provider": &m.Provider,
+                "endpoint": &m.Endpoint,
+                "prefix":   &m.Prefix,
+            }
+            for k, f := range fields {
+                if v, exists := c_t[k]; exists {
+                    *f = util.ToString(v)
+                }
+            }
+            if v, exists := c_t["optional"]; exists {
+                m.Optional = v.(bool)
+            }
+            m.HTTP.Merge(c_t)
+        default:
+            logger.Panicf("%s: invalid instance_metadata config %v", origin, c)
+    }
+    m.Endpoint = strings.TrimSuffix(m.Endpoint, "/")
+
+    if _, exists := metadataFetchers[m.Provider]; !exists && m.Provider != "auto" && m.Provider != "" {
+        logger.Panicf("%s: unknown instance_metadata provider %s", origin, m.Provider)
+    }
+}
+
+func (m *InstanceMetadataSource) fetch() (map[string]string, error) {
+    providers := []string{m.Provider}
+    if m.Provider == "auto" {
+        providers = []string{"ec2", "gce"}
+    }
+
+    client := m.HTTP.Client()
+    var errs []string
+    for _, p := range providers {
+        logger.Debugf("Fetching %s instance metadata from %s\n", p, m.Endpoint)
+        meta, err := metadataFetchers[p](client, m.Endpoint)
+        if err == nil {
+            return meta, nil
+        }
+        errs = append(errs, p + ": " + err.Error())
+    }
+    return nil, fmt.Errorf("No instance metadata: %s", strings.Join(errs, "; "))
+}
+
+func (m *InstanceMetadataSource) DeployablesForEnvironment(environment string) *Deployables {
+    if m.Provider == "" || m.Deployables != nil {
+        return m.Deployables
+    }
+
+    meta, err := m.fetch()
+    if err != nil {
+        if !m.Optional {
+            panic(err)
+        }
+        logger.Printf("Optional instance_metadata: %s\n", err)
+        meta = map[string]string{}
+    }
+
+    vars := make(Vars)
+    for _, n := range InstanceMetadataVars {
+        vars[m.Prefix + n] = meta[n]
+    }
+    m.AddHistory("instance_metadata " + m.Endpoint, vars)
+
+    m.Deployables = &Deployables{vars, make(Specs)}
+    return m.Deployables
+}
+
+func MakeInstanceMetadataSource() SourceInterface {
+    return &InstanceMetadataSource{
+        Endpoint:   DefaultMetadataEndpoint,
+        Prefix:     DefaultMetadataPrefix,
+        HTTP:       &util.HTTPClientConfig{Timeout: DefaultMetadataTimeout},
+        BaseSource: MakeBaseSource(),
+    }
+}
+
+func init() {
+    RegisterSource("instance_metadata", MakeInstanceMetadataSource, 10, false)
+}
@@ -0,0 +1,108 @@
+package sources
+
+import (
+    "net/http"
+    "net/http/httptest"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+// Minimal EC2 IMDSv2 stand-in
+func ec2MetadataTestServer() *httptest.Server {
+    meta := map[string]string{
+        "instance-id": "i-0123456789",
+        "instance-type": "t3.micro",
+        "placement/region": "eu-west-1",
+        "placement/availability-zone": "eu-west-1a",
+        "local-ipv4": "10.0.0.5",
+        "local-hostname": "ip-10-0-0-5.eu-west-1.compute.internal",
+    }
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/latest/api/token" {
+            if r.Method != "PUT" || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+                http.Error(w, "", http.StatusBadRequest)
+                return
+            }
+            w.Write([]byte("imds-token"))
+            return
+        }
+        if r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+            http.Error(w, "", http.StatusUnauthorized)
+            return
+        }
+        v, exists := meta[r.URL.Path[len("/latest/meta-data/"):]]
+        if !exists {
+            http.NotFound(w, r)
+            return
+        }
+        w.Write([]byte(v))
+    }))
+}
+
+// Minimal GCE metadata server stand-in
+func gceMetadataTestServer() *httptest.Server {
+    meta := map[string]string{
+        "id": "4567",
+        "machine-type": "projects/123/machineTypes/e2-small",
+        "zone": "projects/123/zones/us-central1-b",
+        "network-interfaces/0/ip": "10.128.0.7",
+        "hostname": "vm1.us-central1-b.c.project.internal",
+    }
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Metadata-Flavor") != "Google" {
+            http.Error(w, "", http.StatusForbidden)
+            return
+        }
+        v, exists := meta[r.URL.Path[len("/computeMetadata/v1/instance/"):]]
+        if !exists {
+            http.NotFound(w, r)
+            return
+        }
+        w.Write([]byte(v + "\n"))
+    }))
+}
+
+func Test_InstanceMetadataSource(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    ec2 := ec2MetadataTestServer()
+    defer ec2.Close()
+    gce := gceMetadataTestServer()
+    defer gce.Close()
+
+    ms := MakeInstanceMetadataSource()
+    ms.MergeConfig("test", util.AnyMap{"provider": "ec2", "endpoint": ec2.URL})
+    assert.Equal(t, Vars{
+        "meta_provider": "ec2",
+        "meta_instance_id": "i-0123456789",
+        "meta_instance_type": "t3.micro",
+        "meta_region": "eu-west-1",
+        "meta_zone": "eu-west-1a",
+        "meta_private_ip": "10.0.0.5",
+        "meta_hostname": "ip-10-0-0-5.eu-west-1.compute.internal",
+    }, ms.DeployablesForEnvironment("prod").Vars, "ec2 metadata vars")
+
+    ms = MakeInstanceMetadataSource()
+    ms.MergeConfig("test", util.AnyMap{"endpoint": gce.URL, "prefix": "gce_"})
+    assert.Equal(t, Vars{
+        "gce_provider": "gce",
+        "gce_instance_id": "4567",
+        "gce_instance_type": "e2-small",
+        "gce_region": "us-central1",
+        "gce_zone": "us-central1-b",
+        "gce_private_ip": "10.128.0.7",
+        "gce_hostname": "vm1.us-central1-b.c.project.internal",
+    }, ms.DeployablesForEnvironment("prod").Vars, "gce metadata vars, auto detected")
+
+    ms = MakeInstanceMetadataSource()
+    ms.MergeConfig("test", util.AnyMap{"provider": "gce", "endpoint": ec2.URL})
+    assert.Panics(t, func() { ms.DeployablesForEnvironment("prod") }, "no gce metadata")
+
+    ms.MergeConfig("test", util.AnyMap{"optional": true})
+    assert.Equal(t, "", ms.DeployablesForEnvironment("prod").Vars["meta_region"], "optional metadata")
+
+    assert.Nil(t, MakeInstanceMetadataSource().DeployablesForEnvironment("prod"), "instance_metadata not configured")
+    assert.Panics(t, func() { MakeInstanceMetadataSource().MergeConfig("test", "azure") }, "unknown provider")
+}
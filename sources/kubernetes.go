@@ -0,0 +1,183 @@
+// Infrastructure for Kubernetes pod info - Downward API volume and
+// POD_* env vars
+
+package sources
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const (
+    DefaultDownwardAPIDir = "/etc/podinfo"
+    DefaultPodVarsPrefix  = "pod_"
+)
+
+// Downward API files that hold key="value" lines
+var DownwardAPIMapFiles = map[string]bool{
+    "labels":      true,
+    "annotations": true,
+}
+
+// Parses Downward API key="value" lines
+func ParseDownwardAPIMap(data []byte) map[string]string {
+    m := make(map[string]string)
+    for _, line := range strings.Split(string(data), "\n") {
+        i := strings.Index(line, "=")
+        if i < 1 {
+            continue
+        }
+        k, v := line[:i], line[i + 1:]
+        if uq, err := strconv.Unquote(v); err == nil {
+            v = uq
+        }
+        m[k] = v
+    }
+    return m
+}
+
+// Pod info from POD_* env vars (POD_NAME -> name), and NODE_NAME
+func PodEnvVars() map[string]string {
+    vars := make(map[string]string)
+    for _, e := range os.Environ() {
+        kv := strings.SplitN(e, "=", 2)
+        switch {
+            case strings.HasPrefix(kv[0], "POD_"):
+                vars[strings.ToLower(strings.TrimPrefix(kv[0], "POD_"))] = kv[1]
+            case kv[0] == "NODE_NAME":
+                vars["node_name"] = kv[1]
+        }
+    }
+    return vars
+}
+
+// kubernetes Source. Each Downward API file becomes a var, labels and
+// annotations become maps, their keys are not split on dots.
+// POD_* env vars trump files.
+type KubernetesSource struct {
+    Enabled  bool
+    Dir      string
+    Prefix   string
+    Env      bool
+    Optional bool
+
+    *Deployables
+    BaseSource
+}
+// Config is true, or a map with downward_dir, prefix, env and optional keys.
+func (k *KubernetesSource) MergeConfig(origin string, c interface{}) {
+    k.AddHistory(origin, c)
+
+    switch c_t := c.(type) {
+        case bool:
+            k.Enabled = c_t
+        case util.AnyMap:
+            k.Enabled = true
+            if v, exists := c_t["downward_dir"]; exists {
+                k.Dir = util.ToString(v)
+            }
+            if v, exists := c_t["prefix"]; exists {
+                k.Prefix = util.ToString(v)
+            }
+            if v, exists := c_t["env"]; exists {
+                k.Env = v.(bool)
+            }
+            if v, exists := c_t["optional"]; exists {
+                k.Optional = v.(bool)
+            }
+        default:
+            logger.Panicf("%s: invalid kubernetes config %v", origin, c)
+    }
+    k.Deployables = nil
+}
+
+func (k *KubernetesSource) readDir() util.AnyMap {
+    pod := make(util.AnyMap)
+
+    dir_entries, err := ioutil.ReadDir(k.Dir)
+    if err != nil {
+        if os.IsNotExist(err) && k.Optional {
+            logger.Debugf("Optional Downward API dir %s not found\n", k.Dir)
+            return pod
+        }
+        panic(err)
+    }
+
+    for _, entry := range dir_entries {
+        name := entry.Name()
+        // Kubernetes keeps the real files in ..data/ and such
+        if strings.HasPrefix(name, ".") {
+            continue
+        }
+        path := filepath.Join(k.Dir, name)
+        stat, err := os.Stat(path)  // follow symlinks
+        if err != nil {
+            panic(err)
+        }
+        if !stat.Mode().IsRegular() {
+            continue
+        }
+
+        content := util.SlurpFile(path)
+        if DownwardAPIMapFiles[name] {
+            m := make(util.AnyMap)
+            for n, v := range ParseDownwardAPIMap(content) {
+                m[n] = v
+            }
+            pod[name] = m
+        } else {
+            pod[name] = strings.TrimRight(string(content), "\r\n")
+        }
+    }
+    return pod
+}
+
+func (k *KubernetesSource) DeployablesForEnvironment(environment string) *Deployables {
+    if !k.Enabled {
+        return nil
+    }
+    if k.Deployables != nil {
+        return k.Deployables
+    }
+
+    pod := make(util.AnyMap)
+    if k.Dir != "" {
+        logger.Debugf("Loading pod info from %s\n", k.Dir)
+        pod = k.readDir()
+    }
+    if k.Env {
+        for n, v := range PodEnvVars() {
+            pod[n] = v
+        }
+    }
+
+    vars := make(util.AnyMap)
+    for n, v := range pod {
+        vars[k.Prefix + n] = v
+        if DownwardAPIMapFiles[n] {
+            MarkUnsplitSubtree(k.Prefix + n)
+        }
+    }
+    k.AddHistory("kubernetes " + k.Dir, vars)
+
+    k.Deployables = MakeDeployables(AsDeployablesMap(util.AnyMap{GlobalVarsKey: vars}))
+    return k.Deployables
+}
+
+func MakeKubernetesSource() SourceInterface {
+    return &KubernetesSource{
+        Dir:        DefaultDownwardAPIDir,
+        Prefix:     DefaultPodVarsPrefix,
+        Env:        true,
+        BaseSource: MakeBaseSource(),
+    }
+}
+
+func init() {
+    RegisterSource("kubernetes", MakeKubernetesSource, 55, false)
+}
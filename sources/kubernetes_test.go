@@ -0,0 +1,72 @@
+package sources
+
+import (
+    "os"
+    "path/filepath"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+func Test_KubernetesSource(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    dir := t.TempDir()
+    util.Mkdir(filepath.Join(dir, "..2021_01_01"))
+    fixtures := map[string]string{
+        "..2021_01_01/labels": "app=\"web\"\ntier=\"frontend\"\napp.kubernetes.io/name=\"shop\"\n",
+        "..2021_01_01/annotations": "kubernetes.io/config.seen=\"2021-01-01T00:00:00Z\"\nnote=\"multi\\nline\"\n",
+        "..2021_01_01/name": "web-5d8f-x2x\n",
+    }
+    for name, content := range fixtures {
+        util.WriteFile(filepath.Join(dir, name), []byte(content))
+    }
+    for _, name := range []string{"labels", "annotations", "name"} {
+        if err := os.Symlink(filepath.Join("..2021_01_01", name), filepath.Join(dir, name)); err != nil {
+            panic(err)
+        }
+    }
+
+    os.Setenv("POD_NAMESPACE", "shop")
+    os.Setenv("NODE_NAME", "node1")
+    defer os.Unsetenv("POD_NAMESPACE")
+    defer os.Unsetenv("NODE_NAME")
+
+    ks := MakeKubernetesSource()
+    assert.Nil(t, ks.DeployablesForEnvironment("prod"), "kubernetes not configured")
+
+    ks.MergeConfig("test", util.AnyMap{"downward_dir": dir})
+    vars := ks.DeployablesForEnvironment("prod").Vars
+    assert.Equal(t, "web-5d8f-x2x", vars["pod_name"], "pod name from file")
+    assert.Equal(t, "shop", vars["pod_namespace"], "pod namespace from env")
+    assert.Equal(t, "node1", vars["pod_node_name"], "node name from env")
+    assert.Equal(t, "web", vars["pod_labels.app"], "pod label")
+    assert.Equal(t, "multi\nline", vars["pod_annotations.note"], "pod annotation")
+    assert.Equal(t, "shop", vars["pod_labels.app.kubernetes.io/name"], "dotted pod label")
+    labels := util.AnyMap{"app": "web", "tier": "frontend", "app.kubernetes.io/name": "shop"}
+    assert.Equal(t, labels, vars.Subtree("pod_labels"), "pod labels subtree, keys not split")
+    assert.Equal(t, labels, vars.Subtree("")["pod_labels"], "pod labels in all vars")
+    assert.Equal(t, util.AnyMap{"kubernetes.io/name": "shop"}, vars.Subtree("pod_labels.app"), "pod labels below unsplit prefix")
+    assert.Equal(t, "2021-01-01T00:00:00Z", vars.Subtree("pod_annotations")["kubernetes.io/config.seen"], "pod annotations subtree")
+
+    // Pod info trumps config placeholders
+    p := NewProcessor()
+    p.MergeConfig("test", util.AnyMap{
+        "kubernetes": util.AnyMap{"downward_dir": dir},
+        "defaults": util.AnyMap{GlobalVarsKey: util.AnyMap{"pod_name": "placeholder"}},
+        "environments": util.AnyMap{"prod": util.AnyMap{GlobalVarsKey: util.AnyMap{"pod_namespace": "placeholder"}}},
+    })
+    vars = p.Vars("prod")
+    assert.Equal(t, "web-5d8f-x2x", vars["pod_name"], "pod name trumps defaults")
+    assert.Equal(t, "shop", vars["pod_namespace"], "pod namespace trumps environments")
+
+    ks = MakeKubernetesSource()
+    ks.MergeConfig("test", util.AnyMap{"downward_dir": filepath.Join(dir, "nonexist"), "env": false, "prefix": "k8s_"})
+    assert.Panics(t, func() { ks.DeployablesForEnvironment("prod") }, "missing Downward API dir")
+
+    ks.MergeConfig("test", util.AnyMap{"optional": true})
+    assert.Empty(t, ks.DeployablesForEnvironment("prod").Vars, "optional Downward API dir, no env")
+
+    assert.Equal(t, map[string]string{"a": "b c", "d": `"unterminated`}, ParseDownwardAPIMap([]byte("a=\"b c\"\nd=\"unterminated\n\n")), "Downward API map parsing")
+}
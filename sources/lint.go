@@ -0,0 +1,243 @@
+// Config lint. Finds unused vars and templates, and specs without templates
+
+package sources
+
+import (
+    "io"
+    "io/ioutil"
+    "fmt"
+    "sort"
+    "strings"
+    "text/template"
+    "text/template/parse"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+// Lint findings.
+// MissingTemplates and Errors entries are "environment: template[: error]".
+type LintReport struct {
+    UnusedVars       []string
+    UnusedTemplates  []string
+    MissingTemplates []string
+    Errors           []string
+}
+func (r *LintReport) Empty() bool {
+    return len(r.UnusedVars) == 0 && len(r.UnusedTemplates) == 0 &&
+        len(r.MissingTemplates) == 0 && len(r.Errors) == 0
+}
+func (r *LintReport) Print(out io.Writer) {
+    sections := []struct{
+        title string
+        lines []string
+    }{
+        {"Unused vars",                  r.UnusedVars},
+        {"Unused templates",             r.UnusedTemplates},
+        {"Specs with missing templates", r.MissingTemplates},
+        {"Errors",                       r.Errors},
+    }
+    for _, s := range sections {
+        if len(s.lines) == 0 {
+            continue
+        }
+        fmt.Fprintf(out, "%s:\n", s.title)
+        for _, l := range s.lines {
+            fmt.Fprintf(out, "    %s\n", l)
+        }
+    }
+}
+func (r *LintReport) String() string {
+    var b strings.Builder
+    r.Print(&b)
+    return b.String()
+}
+
+// Var names referenced in the template content, either as fields (.var, $.var)
+// or as val "var" calls with a literal argument.
+func TemplateFields(t *template.Template) map[string]bool {
+    fields := make(map[string]bool)
+
+    var walk func(node parse.Node)
+    walk = func(node parse.Node) {
+        switch n := node.(type) {
+            case *parse.ListNode:
+                if n == nil {
+                    return
+                }
+                for _, n1 := range n.Nodes {
+                    walk(n1)
+                }
+            case *parse.ActionNode:
+                walk(n.Pipe)
+            case *parse.IfNode:
+                walk(n.Pipe)
+                walk(n.List)
+                walk(n.ElseList)
+            case *parse.RangeNode:
+                walk(n.Pipe)
+                walk(n.List)
+                walk(n.ElseList)
+            case *parse.WithNode:
+                walk(n.Pipe)
+                walk(n.List)
+                walk(n.ElseList)
+            case *parse.TemplateNode:
+                walk(n.Pipe)
+            case *parse.PipeNode:
+                if n == nil {
+                    return
+                }
+                for _, c := range n.Cmds {
+                    walk(c)
+                }
+            case *parse.CommandNode:
+                if len(n.Args) > 1 {
+                    if id, ok := n.Args[0].(*parse.IdentifierNode); ok && id.Ident == "val" {
+                        if s, ok := n.Args[1].(*parse.StringNode); ok {
+                            fields[s.Text] = true
+                        }
+                    }
+                }
+                for _, a := range n.Args {
+                    walk(a)
+                }
+            case *parse.ChainNode:
+                walk(n.Node)
+            case *parse.FieldNode:
+                fields[n.Ident[0]] = true
+            case *parse.VariableNode:
+                if len(n.Ident) > 1 {
+                    fields[n.Ident[1]] = true
+                }
+        }
+    }
+
+    for _, t1 := range t.Templates() {
+        if t1.Tree != nil {
+            walk(t1.Tree.Root)
+        }
+    }
+    return fields
+}
+
+// Renders all Specs for all environments, tracking referenced vars.
+// Reports vars that were never referenced, templates that no Spec uses,
+// and Specs without a template.
+func (p *Processor) Lint() *LintReport {
+    report := new(LintReport)
+
+    defined := make(map[string]bool)
+    used := make(map[string]bool)
+    used_templates := make(map[string]bool)
+
+    environments := p.ListEnvironments()
+    if len(environments) == 0 {
+        environments = []string{""}
+    }
+    sort.Strings(environments)
+
+    for _, environment := range environments {
+        specs := p.Specs(environment)
+
+        names := make([]string, 0, len(specs))
+        for n, _ := range specs {
+            names = append(names, n)
+        }
+        sort.Strings(names)
+
+        for _, name := range names {
+            s := specs[name]
+            if s.Enabled != nil && !*s.Enabled {
+                continue
+            }
+            for v, _ := range s.Vars {
+                defined[v] = true
+            }
+
+            var t *Template
+            if s.Format != "" {
+                t = s.FormatTemplate()
+            } else {
+                t = p.Template(name)
+                if t == nil {
+                    report.MissingTemplates = append(report.MissingTemplates, environment + ": " + name)
+                    continue
+                }
+                used_templates[name] = true
+            }
+
+            v := s.Vars.Clone()
+            if _, exists := v["environment"]; !exists {
+                v["environment"] = environment
+            }
+            if err := lintTemplate(t, v, used); err != nil {
+                report.Errors = append(report.Errors, fmt.Sprintf("%s: %s: %s", environment, name, err))
+            }
+            if s.When != "" {
+                if err := lintTemplate(whenTemplate(s.When, p.NoHostFunctions), v, used); err != nil {
+                    report.Errors = append(report.Errors, fmt.Sprintf("%s: %s: when: %s", environment, name, err))
+                }
+            }
+        }
+    }
+
+    for v, _ := range defined {
+        if !used[v] && v != "environment" {
+            report.UnusedVars = append(report.UnusedVars, v)
+        }
+    }
+    sort.Strings(report.UnusedVars)
+
+    for _, ts := range p.ListTemplates() {
+        for name, _ := range ts {
+            if !used_templates[name] {
+                report.UnusedTemplates = append(report.UnusedTemplates, name)
+                used_templates[name] = true  // reported
+            }
+        }
+    }
+    sort.Strings(report.UnusedTemplates)
+
+    return report
+}
+
+// Renders the template into the void, recording referenced vars in used.
+func lintTemplate(t *Template, v Vars, used map[string]bool) (err error) {
+    defer func() {
+        if r := recover(); r != nil {
+            err = fmt.Errorf("%v", r)
+        }
+    }()
+
+    func_map := t.baseFuncMap()
+    func_map["val"] = func(var_name string) string {
+        used[var_name] = true
+        return v[var_name]
+    }
+    func_map["subtree"] = func(prefix string) util.AnyMap {
+        for n, _ := range v {
+            if prefix == "" || strings.HasPrefix(n, prefix + SubtreeSeparator) {
+                used[n] = true
+            }
+        }
+        return v.Subtree(prefix)
+    }
+    t_parsed, err := template.New("").Funcs(func_map).Parse(t.Content)
+    if err != nil {
+        return err
+    }
+    for f, _ := range TemplateFields(t_parsed) {
+        used[f] = true
+    }
+
+    t_lint := *t
+    t_lint.Funcs = template.FuncMap{"val": func_map["val"], "subtree": func_map["subtree"]}
+    for n, f := range t.Funcs {
+        if _, exists := t_lint.Funcs[n]; !exists {
+            t_lint.Funcs[n] = f
+        }
+    }
+    t_lint.Write(ioutil.Discard, v)
+
+    return nil
+}
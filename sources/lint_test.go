@@ -0,0 +1,53 @@
+package sources
+
+import (
+    "path/filepath"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+const lint_common_yaml = `
+defaults:
+    _vars:
+        used_global: a
+        unused_global: b
+    t1.conf:
+        target: /t1.conf
+        vars:
+            used_by_val: c
+            used_in_branch: d
+            unused_t1: e
+    missing.conf:
+        target: /missing.conf
+environments:
+    env1:
+        t1.conf:
+            vars:
+                unused_env1: f
+`
+const lint_t1_conf = `{{.used_global}}
+{{$v := "used_by_val"}}{{val $v}}
+{{if false}}{{.used_in_branch}}{{end}}
+`
+
+func Test_Lint(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    dir := t.TempDir()
+    util.WriteFile(filepath.Join(dir, ConfigFname), []byte(lint_common_yaml))
+    templates_dir := filepath.Join(dir, TemplatesSubdir)
+    util.Mkdir(templates_dir)
+    util.WriteFile(filepath.Join(templates_dir, "t1.conf"), []byte(lint_t1_conf))
+    util.WriteFile(filepath.Join(templates_dir, "unused.conf"), []byte(""))
+
+    report := LoadConfigsFromDir(dir).Lint()
+
+    assert.Equal(t, &LintReport{
+        UnusedVars:       []string{"unused_env1", "unused_global", "unused_t1"},
+        UnusedTemplates:  []string{"unused.conf"},
+        MissingTemplates: []string{"env1: missing.conf"},
+    }, report, "Lint()")
+    assert.False(t, report.Empty(), "Lint() Empty()")
+}
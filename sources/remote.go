@@ -0,0 +1,73 @@
+// Helpers for sources that fetch vars from remote services
+
+package sources
+
+import (
+    "strings"
+    "text/template"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+// Expands {{environment}} and {{hostname}} in paths, URLs, key prefixes etc.
+func ExpandForEnvironment(s string, environment string) string {
+    funcs := template.FuncMap{
+        "environment": func() string { return environment },
+        "hostname":    util.Hostname,
+    }
+    t := template.Must( template.New("").Funcs(funcs).Parse(s) )
+
+    var b strings.Builder
+    if err := t.Execute(&b, nil); err != nil {
+        panic(err)
+    }
+    return b.String()
+}
+
+// Adds vars to a deployables map, into template vars if template is
+// specified, global vars otherwise.
+func MergeVarsInto(deployables util.AnyMap, template string, vars util.AnyMap) {
+    var target util.AnyMap
+    if template == "" {
+        target, _ = deployables[GlobalVarsKey].(util.AnyMap)
+        if target == nil {
+            target = make(util.AnyMap)
+            deployables[GlobalVarsKey] = target
+        }
+    } else {
+        spec, _ := deployables[template].(util.AnyMap)
+        if spec == nil {
+            spec = make(util.AnyMap)
+            deployables[template] = spec
+        }
+        target, _ = spec["vars"].(util.AnyMap)
+        if target == nil {
+            target = make(util.AnyMap)
+            spec["vars"] = target
+        }
+    }
+
+    for n, val := range vars {
+        target[n] = val
+    }
+}
+
+// Key/value store prefix as a folder, with a trailing "/", so config/prod
+// does not take config/production keys
+func FolderPrefix(prefix string) string {
+    if strings.HasSuffix(prefix, "/") {
+        return prefix
+    }
+    return prefix + "/"
+}
+
+// Turns key/value store keys under prefix into a deployables map.
+// Key paths relative to prefix become nested vars, or Templates structure
+// if there is a _vars/ key.
+func KeysDeployablesMap(kv map[string]string, prefix string) util.AnyMap {
+    vars := make(map[string]string)
+    for k, v := range kv {
+        vars[strings.TrimPrefix(strings.TrimPrefix(k, prefix), "/")] = v
+    }
+    return AsDeployablesMap(util.Unflatten(vars, "/"))
+}
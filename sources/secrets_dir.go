@@ -0,0 +1,113 @@
+// Infrastructure for secrets dirs - one file per var, as Docker swarm
+// and Kubernetes mount secrets and configmaps
+
+package sources
+
+import (
+    "os"
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const DefaultSecretMaxSize = 64 * 1024
+
+// Secrets dir options
+type SecretsDirConfig struct {
+    Dirs     []string
+    Trim     bool
+    Prefix   string
+    MaxSize  int64
+    Optional bool
+}
+func MakeSecretsDirConfig(c interface{}) *SecretsDirConfig {
+    sdc := SecretsDirConfig{Trim: true, MaxSize: DefaultSecretMaxSize}
+
+    switch c_t := c.(type) {
+        case string:
+            sdc.Dirs = []string{c_t}
+        case []interface{}:
+            sdc.Dirs = util.ToStrings(c_t)
+        case util.AnyMap:
+            sdc.Dirs = util.ToStrings(c_t["dirs"])
+            if v, exists := c_t["trim"]; exists {
+                sdc.Trim = v.(bool)
+            }
+            sdc.Prefix = util.ToString(c_t["prefix"])
+            if v, exists := c_t["max_size"]; exists {
+                sdc.MaxSize = util.ToInt64(v)
+            }
+            sdc.Optional, _ = c_t["optional"].(bool)
+        default:
+            logger.Panicf("Invalid secrets_dir config %v", c)
+    }
+
+    return &sdc
+}
+
+// A secrets dirs version of DeployablesSource type. No Specs, just Vars.
+// All vars are marked sensitive.
+type SecretsDirSource struct {
+    *DeployablesSource
+    Paths []string
+}
+func (s *SecretsDirSource) MergeConfig(origin string, c interface{}) {
+    sdc := MakeSecretsDirConfig(c)
+
+    for _, dir := range sdc.Dirs {
+        dir_entries, err := ioutil.ReadDir(dir)
+        if err != nil {
+            if os.IsNotExist(err) && sdc.Optional {
+                logger.Debugf("Optional secrets dir %s not found\n", dir)
+                continue
+            }
+            panic(err)
+        }
+        s.Paths = append(s.Paths, dir)
+
+        logger.Debugf("Loading secrets from %s\n", dir)
+        secrets := make(util.AnyMap)
+        for _, entry := range dir_entries {
+            name := entry.Name()
+            // Kubernetes keeps the real files in ..data/ and such
+            if strings.HasPrefix(name, ".") {
+                continue
+            }
+
+            path := filepath.Join(dir, name)
+            stat, err := os.Stat(path)  // follow symlinks
+            if err != nil {
+                panic(err)
+            }
+            if !stat.Mode().IsRegular() {
+                continue
+            }
+            if sdc.MaxSize > 0 && stat.Size() > sdc.MaxSize {
+                logger.Printf("Skipping secret %s, size %d exceeds %d\n", path, stat.Size(), sdc.MaxSize)
+                continue
+            }
+
+            val := string(util.SlurpFile(path))
+            if sdc.Trim {
+                val = strings.TrimRight(val, "\r\n")
+            }
+
+            var_name := sdc.Prefix + name
+            MarkSensitive(var_name)
+            secrets[var_name] = val
+        }
+
+        s.DeployablesSource.MergeConfig(origin + " secrets_dir " + dir, util.AnyMap{GlobalVarsKey: secrets})
+    }
+}
+
+func MakeSecretsDirSource() SourceInterface {
+    ds := MakeDeployablesSource()
+    return &SecretsDirSource{ds.(*DeployablesSource), nil}
+}
+
+func init() {
+    RegisterSource("secrets_dir", MakeSecretsDirSource, 80, false)
+}
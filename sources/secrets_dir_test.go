@@ -0,0 +1,61 @@
+package sources
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+func Test_SecretsDirSource(t *testing.T) {
+    dir := t.TempDir()
+    util.WriteFile(filepath.Join(dir, "db_password"), []byte("s3cr3t\n"))
+    util.WriteFile(filepath.Join(dir, "api_key"), []byte("key\r\n"))
+    util.WriteFile(filepath.Join(dir, "big"), []byte(strings.Repeat("x", 100)))
+    util.Mkdir(filepath.Join(dir, "..data"))
+    util.WriteFile(filepath.Join(dir, "..data", "hidden"), []byte("hidden"))
+    if err := os.Symlink(filepath.Join(dir, "..data", "hidden"), filepath.Join(dir, "linked")); err != nil {
+        panic(err)
+    }
+
+    var buff bytes.Buffer
+    log_w := logger.Writer()
+    logger.SetOutput(&buff)
+    dbg := logger.SetDebug(true)
+    defer func() {
+        logger.SetDebug(dbg)
+        logger.SetOutput(log_w)
+        t.Log(buff.String())
+    }()
+
+    sds := MakeSecretsDirSource()
+    sds.MergeConfig("test", util.AnyMap{
+        "dirs": []interface{}{dir, filepath.Join(dir, "nonexist")},
+        "prefix": "secret_",
+        "max_size": 50,
+        "optional": true,
+    })
+
+    vars := sds.DeployablesForEnvironment("").Vars
+    assert.Equal(t, Vars{
+        "secret_db_password": "s3cr3t",
+        "secret_api_key": "key",
+        "secret_linked": "hidden",
+    }, vars, "secrets_dir vars")
+
+    assert.True(t, IsSensitive("secret_db_password"), "secrets_dir var is sensitive")
+    assert.Equal(t, MaskedValue, vars.Masked()["secret_db_password"], "masked secrets_dir var")
+    assert.NotContains(t, buff.String(), "s3cr3t", "secret in log")
+
+    sds = MakeSecretsDirSource()
+    sds.MergeConfig("test", dir)
+    assert.Equal(t, 4, len(sds.DeployablesForEnvironment("").Vars), "secrets_dir vars, no size limit")
+
+    assert.Panics(t, func() {
+        MakeSecretsDirSource().MergeConfig("test", filepath.Join(dir, "nonexist"))
+    }, "missing secrets dir")
+}
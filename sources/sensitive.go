@@ -0,0 +1,98 @@
+// Sensitive vars registry. Values of sensitive vars are masked in logs.
+// Vars are sensitive if marked by name (secret sources, config), or if
+// their names match a pattern.
+
+package sources
+
+import (
+    "path"
+    "strings"
+    "sync"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const MaskedValue = "********"
+
+// Case insensitive name globs
+var DefaultSensitivePatterns = []string{
+    "*password*",
+    "*passwd*",
+    "*secret*",
+    "*token*",
+    "*private_key*",
+}
+
+var sensitive_vars = struct {
+    sync.RWMutex
+    names    map[string]bool
+    patterns []string
+}{names: make(map[string]bool), patterns: DefaultSensitivePatterns}
+
+// Marks vars as sensitive
+func MarkSensitive(names ...string) {
+    sensitive_vars.Lock()
+    defer sensitive_vars.Unlock()
+
+    for _, n := range names {
+        sensitive_vars.names[n] = true
+    }
+}
+// Marks vars matching name patterns as sensitive
+func MarkSensitivePatterns(patterns ...string) {
+    sensitive_vars.Lock()
+    defer sensitive_vars.Unlock()
+
+    for _, p := range patterns {
+        if _, err := path.Match(p, ""); err != nil {
+            logger.Panicf("Invalid sensitive pattern %s: %s", p, err)
+        }
+        sensitive_vars.patterns = append(sensitive_vars.patterns, strings.ToLower(p))
+    }
+}
+
+// sensitive: config entries - var names or patterns
+func MergeSensitiveConfig(c interface{}) {
+    for _, n := range util.ToStrings(c) {
+        if strings.ContainsAny(n, "*?[") {
+            MarkSensitivePatterns(n)
+        } else {
+            MarkSensitive(n)
+        }
+    }
+}
+
+func IsSensitive(name string) bool {
+    sensitive_vars.RLock()
+    defer sensitive_vars.RUnlock()
+
+    if sensitive_vars.names[name] {
+        return true
+    }
+    lc_name := strings.ToLower(name)
+    for _, p := range sensitive_vars.patterns {
+        if matched, _ := path.Match(p, lc_name); matched {
+            return true
+        }
+    }
+    return false
+}
+
+// Value for displaying purposes - masked if the var is sensitive
+func MaskValue(name string, value string) string {
+    if IsSensitive(name) {
+        return MaskedValue
+    }
+    return value
+}
+// A copy with sensitive values masked, for displaying purposes
+func (vs Vars) Masked() Vars {
+    if vs == nil {
+        return nil
+    }
+    vs_m := make(Vars, len(vs))
+    for n, v := range vs {
+        vs_m[n] = MaskValue(n, v)
+    }
+    return vs_m
+}
@@ -0,0 +1,55 @@
+package sources
+
+import (
+    "bytes"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+func Test_Sensitive(t *testing.T) {
+    for name, expected := range map[string]bool{
+        "db_password": true,
+        "DB_PASSWORD": true,
+        "aws.secret_access_key": true,
+        "github_token": true,
+        "db_host": false,
+    } {
+        assert.Equal(t, expected, IsSensitive(name), name)
+    }
+
+    var buff bytes.Buffer
+    log_w := logger.Writer()
+    logger.SetOutput(&buff)
+    dbg := logger.SetDebug(true)
+    defer func() {
+        logger.SetDebug(dbg)
+        logger.SetOutput(log_w)
+        t.Log(buff.String())
+    }()
+
+    ep := EnvForPrefix(env_vars_prefix)
+    defer ep.Clear()
+    ep.Clear()
+    ep.Set("db_password", "env-pa55")
+    ep.Set("sensitive_marked", "marked-value")
+    ep.Set("sensitive_pattern_x", "pattern-value")
+    ep.Set("plain", "plain-value")
+
+    p := NewProcessor()
+    p.MergeConfig("test", util.AnyMap{
+        "env_vars_prefix": env_vars_prefix,
+        "sensitive": []interface{}{"sensitive_marked", "SENSITIVE_PATTERN_*"},
+    })
+    p.Specs("")
+
+    log := buff.String()
+    for _, secret := range []string{"env-pa55", "marked-value", "pattern-value"} {
+        assert.NotContains(t, log, secret, "sensitive value in log")
+    }
+    assert.Contains(t, log, "plain-value", "plain value in log")
+    assert.Contains(t, log, MaskedValue, "masked value in log")
+
+    assert.Panics(t, func() { MergeSensitiveConfig("[invalid") }, "invalid pattern")
+}
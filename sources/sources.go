@@ -4,21 +4,29 @@
 package sources
 
 import (
+    "bytes"
     "io"
+    "io/ioutil"
     "os"
     "os/user"
     "sync"
     "path/filepath"
     "sort"
+    "strings"
     "fmt"
     "encoding/base64"
+    "regexp"
     "text/template"
 
     "github.com/catalyst/gotiller/util"
     "github.com/catalyst/gotiller/log"
 )
 
-const GlobalVarsKey = "_vars"
+const (
+    GlobalVarsKey             = "_vars"
+    SubtreeSeparator          = "."
+    EnvironmentStackSeparator = ","
+)
 
 var logger = log.DefaultLogger
 
@@ -33,11 +41,11 @@ func (vs Vars) Merge(vars ...Vars) {
         for k, val := range v {
             if ev, exists := vs[k]; exists {
                 if val != ev {
-                    logger.Debugf("Changing var %s to %s\n", k, val)
+                    logger.Debugf("Changing var %s to %s\n", k, MaskValue(k, val))
                     vs[k] = val
                 }
             } else {
-                logger.Debugf("Setting var %s to %s\n", k, val)
+                logger.Debugf("Setting var %s to %s\n", k, MaskValue(k, val))
                 vs[k] = val
             }
         }
@@ -51,12 +59,74 @@ func (vs Vars) SetMissing(vars ...Vars) {
 
         for k, val := range v {
             if _, exists := vs[k]; !exists {
-                logger.Debugf("Setting missing var %s to %s\n", k, val)
+                logger.Debugf("Setting missing var %s to %s\n", k, MaskValue(k, val))
                 vs[k] = val
             }
         }
     }
 }
+// Var names whose subtree keys are not split, ie Kubernetes labels
+// have dots in their keys
+var unsplit_subtrees = struct {
+    sync.RWMutex
+    prefixes map[string]bool
+}{prefixes: make(map[string]bool)}
+
+// Marks var name prefixes whose subtree keys are kept whole
+func MarkUnsplitSubtree(prefixes ...string) {
+    unsplit_subtrees.Lock()
+    defer unsplit_subtrees.Unlock()
+
+    for _, p := range prefixes {
+        unsplit_subtrees.prefixes[p] = true
+    }
+}
+
+// Splits names under prefix on dots, except for keys under unsplit
+// subtrees
+func subtreeSplit(prefix string) func(string) []string {
+    unsplit_subtrees.RLock()
+    var unsplit []string
+    for p := range unsplit_subtrees.prefixes {
+        unsplit = append(unsplit, p)
+    }
+    unsplit_subtrees.RUnlock()
+
+    return func(n string) []string {
+        full := n
+        if prefix != "" {
+            full = prefix + SubtreeSeparator + n
+        }
+        for _, p := range unsplit {
+            if !strings.HasPrefix(full, p + SubtreeSeparator) {
+                continue
+            }
+            // prefix is within the unsplit subtree
+            if len(p) <= len(prefix) {
+                return []string{n}
+            }
+            rel := strings.TrimPrefix(p, prefix + SubtreeSeparator)
+            return append(strings.Split(rel, SubtreeSeparator), n[len(rel) + 1:])
+        }
+        return strings.Split(n, SubtreeSeparator)
+    }
+}
+
+// Vars named prefix.<name> as a nested map, prefix stripped.
+// Names are split on dots, ie "db.primary.host" becomes db: primary: host:
+// Keys under unsplit subtrees (see MarkUnsplitSubtree) are not split.
+// Empty prefix gives all vars.
+func (vs Vars) Subtree(prefix string) util.AnyMap {
+    sub := make(map[string]string)
+    for n, v := range vs {
+        if prefix == "" {
+            sub[n] = v
+        } else if strings.HasPrefix(n, prefix + SubtreeSeparator) {
+            sub[strings.TrimPrefix(n, prefix + SubtreeSeparator)] = v
+        }
+    }
+    return util.UnflattenFunc(sub, subtreeSplit(prefix))
+}
 func (vs Vars) Clone() Vars {
     vs_v := make(Vars)
     for n, v := range vs {
@@ -64,23 +134,56 @@ func (vs Vars) Clone() Vars {
     }
     return vs_v
 }
+var env_name_invalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+// NAME=value env entries for the named vars. A name can be var=ENV_NAME,
+// otherwise the var name is uppercased, ie db.host becomes DB_HOST.
+func (vs Vars) ExportEnv(names []string) []string {
+    var env []string
+    for _, n := range names {
+        pair := strings.SplitN(n, "=", 2)
+        v, exists := vs[pair[0]]
+        if !exists {
+            logger.Panicf("Cannot export %s: no such var", pair[0])
+        }
+        env_name := env_name_invalid.ReplaceAllString(strings.ToUpper(pair[0]), "_")
+        if len(pair) == 2 {
+            env_name = pair[1]
+        }
+        env = append(env, env_name + "=" + v)
+    }
+    return env
+}
 
 // Turns a map into Vars.
+// Encrypted values are decrypted.
 func MakeVars(vs util.AnyMap) Vars {
     vs_v := make(Vars)
     for n, v := range vs {
-        vs_v[n] = util.ToString(v)
+        vs_v[n] = DecryptVar(n, util.ToString(v))
     }
     return vs_v
 }
 
 // Template deployment Spec storage type.
+// Format, if set, generates the target from Vars (or Subtree of Vars)
+// instead of the template.
+// OnChange hooks run when the target content changed, OnDeploy hooks
+// when the content or metadata changed.
+// Validate checks the rendered content before the target is replaced.
+// Spec is skipped if When expression is false, or Enabled is false.
 type Spec struct {
     Target   string
     User     string
     Group    string
     Perms    os.FileMode
+    Format   string
+    Subtree  string
     Vars     Vars
+    OnChange []*Hook
+    OnDeploy []*Hook
+    Validate *Validator
+    When     string
+    Enabled  *bool
 }
 func (s *Spec) Merge(s1 *Spec) {
     if s1.Target != "" && s1.Target != s.Target {
@@ -99,15 +202,120 @@ func (s *Spec) Merge(s1 *Spec) {
         logger.Debugf("Setting target permissions to %s\n", s1.Perms)
         s.Perms = s1.Perms
     }
+    if s1.Format != "" && s1.Format != s.Format {
+        logger.Debugf("Setting target format to %s\n", s1.Format)
+        s.Format = s1.Format
+    }
+    if s1.Subtree != "" && s1.Subtree != s.Subtree {
+        logger.Debugf("Setting target vars subtree to %s\n", s1.Subtree)
+        s.Subtree = s1.Subtree
+    }
     if s1.Vars != nil {
         if s.Vars == nil {
             s.Vars = make(Vars)
         }
         s.Vars.Merge(s1.Vars)
     }
+    if s1.OnChange != nil {
+        logger.Debugln("Setting on_change hooks")
+        s.OnChange = s1.OnChange
+    }
+    if s1.OnDeploy != nil {
+        logger.Debugln("Setting on_deploy hooks")
+        s.OnDeploy = s1.OnDeploy
+    }
+    if s1.Validate != nil {
+        logger.Debugln("Setting validate command")
+        s.Validate = s1.Validate
+    }
+    if s1.When != "" && s1.When != s.When {
+        logger.Debugf("Setting when to %s\n", s1.When)
+        s.When = s1.When
+    }
+    if s1.Enabled != nil {
+        logger.Debugf("Setting enabled to %t\n", *s1.Enabled)
+        s.Enabled = s1.Enabled
+    }
+}
+// Template functions for Spec Format values
+var FormatFuncs = map[string]string{
+    "json" : "toPrettyJson",
+    "yaml" : "toYaml",
+    "toml" : "toToml",
+    "ini"  : "toIni",
+    "shell": "toShell",
+    "env"  : "toShell",
+}
+// Makes a Template that serialises Vars (Subtree) according to Format.
+// Values that look like booleans and integers are typed.
+func (s *Spec) FormatTemplate() *Template {
+    fn, exists := FormatFuncs[s.Format]
+    if !exists {
+        logger.Panicf("Unknown format %s", s.Format)
+    }
+
+    content := fmt.Sprintf("{{%s (typed (subtree %q))}}", fn, s.Subtree)
+    if fn == "toPrettyJson" || fn == "toYaml" {
+        content += "\n"
+    }
+    return &Template{Path: "format " + s.Format, Content: content}
+}
+// Renders into a temp file next to the target, validates it and renames
+// it into place, so the target is never seen half written.
+// The temp file gets the configured perms, or the existing target mode,
+// before validation. An existing target keeps its owner if possible.
+// If it is a symlink the file it points to is replaced.
+func (s *Spec) replace(target_path string, content []byte, exists bool) {
+    mode := os.FileMode(0666)
+    var stat os.FileInfo
+    if exists {
+        real_path, err := filepath.EvalSymlinks(target_path)
+        if err != nil {
+            panic(err)
+        }
+        target_path = real_path
+        if stat, err = os.Stat(target_path); err != nil {
+            panic(err)
+        }
+        mode = stat.Mode().Perm()
+    }
+    // Content may be secret, so configured perms from the start
+    if s.Perms != os.FileMode(0) {
+        mode = s.Perms
+    }
+
+    tmp_path := util.WriteTempFile(target_path, content, mode)
+    defer os.Remove(tmp_path)
+
+    if stat != nil || s.Perms != os.FileMode(0) {
+        if err := os.Chmod(tmp_path, mode); err != nil {
+            panic(err)
+        }
+    }
+    if stat != nil {
+        uid, gid := util.FileOwner(stat)
+        if uid != os.Getuid() || gid != os.Getgid() {
+            if err := os.Chown(tmp_path, uid, gid); err != nil {
+                logger.Printf("Cannot keep %s owner: %s\n", target_path, err)
+            }
+        }
+    }
+
+    if s.Validate != nil {
+        if err := s.Validate.Validate(tmp_path); err != nil {
+            logger.Panicf("%s not deployed: %s", target_path, err)
+        }
+    }
+
+    logger.Printf("Writing %s\n", target_path)
+    if err := os.Rename(tmp_path, target_path); err != nil {
+        panic(err)
+    }
 }
-// Turns template into the target, setting the permissions/ownership
-func (s *Spec) Deploy(t *Template, base_dir string) {
+
+// Turns template into the target, setting the permissions/ownership.
+// Target is written only if the content changed, and passed validation.
+func (s *Spec) Deploy(t *Template, base_dir string) *DeployResult {
     target_path := s.Target
     if target_path == "" {
         panic("No target")
@@ -115,23 +323,35 @@ func (s *Spec) Deploy(t *Template, base_dir string) {
     if base_dir != "" {
         target_path = filepath.Join(base_dir, target_path)
     }
+    result := DeployResult{Target: target_path}
 
-    logger.Printf("Writing %s\n", target_path)
+    var content bytes.Buffer
+    t.Write(&content, s.Vars)
+
+    existing, err := ioutil.ReadFile(target_path)
+    if err != nil && !os.IsNotExist(err) {
+        panic(err)
+    }
+    if err != nil || !bytes.Equal(existing, content.Bytes()) {
+        dir, _ := filepath.Split(target_path)
+        util.Mkdir(dir)
 
-    dir, _ := filepath.Split(target_path)
-    util.Mkdir(dir)
+        s.replace(target_path, content.Bytes(), err == nil)
+        result.ContentChanged = true
+    } else {
+        logger.Printf("%s not changed\n", target_path)
+    }
 
-    out, err := os.Create(target_path)
+    stat, err := os.Stat(target_path)
     if err != nil {
         panic(err)
     }
 
-    t.Write(out, s.Vars)
-
-    if s.Perms != os.FileMode(0) {
-        if err := out.Chmod(s.Perms); err != nil {
+    if s.Perms != os.FileMode(0) && stat.Mode().Perm() != s.Perms {
+        if err := os.Chmod(target_path, s.Perms); err != nil {
             panic(err)
         }
+        result.MetadataChanged = true
     }
 
     if s.User != "" || s.Group != "" {
@@ -159,14 +379,15 @@ func (s *Spec) Deploy(t *Template, base_dir string) {
 
         uid := util.AtoI(uid_s)
         gid := util.AtoI(gid_s)
-        if err = out.Chown(uid, gid); err != nil {
-            panic(err)
+        if f_uid, f_gid := util.FileOwner(stat); uid != f_uid || gid != f_gid {
+            if err = os.Chown(target_path, uid, gid); err != nil {
+                panic(err)
+            }
+            result.MetadataChanged = true
         }
     }
 
-    if err := out.Close(); err != nil {
-        panic(err)
-    }
+    return &result
 }
 
 // Turns a map into Spec.
@@ -175,6 +396,9 @@ func MakeSpec(m util.AnyMap) *Spec {
         Target:   util.ToString(m["target"]),
         User:     util.ToString(m["user"]),
         Group:    util.ToString(m["group"]),
+        Format:   util.ToString(m["format"]),
+        Subtree:  util.ToString(m["subtree"]),
+        When:     util.ToString(m["when"]),
     }
     if v, exists := m["perms"]; exists {
         d.Perms = os.FileMode(v.(int))
@@ -182,8 +406,26 @@ func MakeSpec(m util.AnyMap) *Spec {
     if v, exists := m["vars"]; exists {
         d.Vars = MakeVars(v.(util.AnyMap))
     }
+    if v, exists := m["on_change"]; exists {
+        d.OnChange = MakeHooks(v)
+    }
+    if v, exists := m["on_deploy"]; exists {
+        d.OnDeploy = MakeHooks(v)
+    }
+    if v, exists := m["validate"]; exists {
+        d.Validate = MakeValidator(v)
+    }
+    if v, exists := m["enabled"]; exists {
+        enabled, err := util.ToBool(v)
+        if err != nil {
+            logger.Panicf("Invalid enabled: %s", err)
+        }
+        d.Enabled = &enabled
+    }
 
-    logger.Debugf("Made deployable %v\n", d)
+    d_m := d
+    d_m.Vars = d.Vars.Masked()
+    logger.Debugf("Made deployable %v\n", d_m)
     return &d
 }
 
@@ -250,6 +492,36 @@ func (ds *Deployables) PreparedSpecs() Specs {
     return specs
 }
 
+// Takes a map with a _vars key as Templates structure,
+// otherwise as a (possibly nested) set of global vars.
+// Nested maps and lists in vars are flattened into "a.b.c" names.
+func AsDeployablesMap(m util.AnyMap) util.AnyMap {
+    if _, exists := m[GlobalVarsKey]; !exists {
+        m = util.AnyMap{GlobalVarsKey: m}
+    }
+
+    flat := make(util.AnyMap)
+    for n, v := range m {
+        v_m, is_map := v.(util.AnyMap)
+        switch {
+            case !is_map:
+                flat[n] = v
+            case n == GlobalVarsKey:
+                flat[n] = util.Flatten(v_m, SubtreeSeparator)
+            default:
+                spec := make(util.AnyMap)
+                for k, sv := range v_m {
+                    spec[k] = sv
+                }
+                if vars, is_map := v_m["vars"].(util.AnyMap); is_map {
+                    spec["vars"] = util.Flatten(vars, SubtreeSeparator)
+                }
+                flat[n] = spec
+        }
+    }
+    return flat
+}
+
 // Turns a map into Deployables.
 func MakeDeployables(m util.AnyMap) *Deployables {
     var vars Vars
@@ -306,16 +578,34 @@ func CloneFuncMap() template.FuncMap {
 }
 
 // Tempate storage type
+// Funcs, if set, are added to the FuncMap mix when processing.
+// NoHostFuncs leaves HostFuncs out of the mix.
 type Template struct {
-    Path    string
-    Content string
+    Path        string
+    Content     string
+    Funcs       template.FuncMap
+    NoHostFuncs bool
+}
+// FuncMap clone, without HostFuncs if disabled
+func (t *Template) baseFuncMap() template.FuncMap {
+    func_map := CloneFuncMap()
+    if t.NoHostFuncs {
+        for n := range HostFuncs {
+            delete(func_map, n)
+        }
+    }
+    return func_map
 }
 // Feeds the processed template to the writer.
 // Adds "val" funtion to the FuncMap mix, so templates can access
-// variables directly by the name.
+// variables directly by the name, and "subtree" for nested vars.
 func (t *Template) Write(out io.Writer, v Vars) {
-    func_map := CloneFuncMap()
+    func_map := t.baseFuncMap()
     func_map["val"] = func(var_name string) string { return v[var_name] }
+    func_map["subtree"] = v.Subtree
+    for n, f := range t.Funcs {
+        func_map[n] = f
+    }
 
     t_exec := template.Must( template.New("").Funcs(func_map).Parse(t.Content) )
     if err := t_exec.Execute(out, v); err != nil {
@@ -393,10 +683,10 @@ func (rs *RegisteredSources) NewProcessor() *Processor {
         return sorted[i].order < sorted[j].order
     })
 
-    p := new(Processor)
+    p := &Processor{Supervise: MakeSuperviseConfig()}
 
     for _, s := range sorted {
-        p.add(s.name, s.SourceFactory())
+        p.add(s.name, s.order, s.SourceFactory())
     }
     return p
 }
@@ -405,16 +695,42 @@ func (rs *RegisteredSources) NewProcessor() *Processor {
 // A named Source - type that implements SourceInterface
 type SourceInstance struct {
     Name   string
+    Order  int
     SourceInterface
 }
 // The main workhorse - a collection of SourceInstances that applies
 // Vars hierarchically to Templates
 type Processor struct {
     DefaultEnvironment string
+    EnvironmentFromEnv string
+    EnvironmentRules   []*EnvironmentRule
+    ReadableDirs       util.ReadableDirs
+    AfterRun           []*Hook
+    Supervise          *SuperviseConfig
+    NoHostFunctions    bool
     Sources            []*SourceInstance
 }
-func (p *Processor) add(name string, s SourceInterface) {
-    p.Sources = append(p.Sources, &SourceInstance{name, s})
+func (p *Processor) add(name string, order int, s SourceInterface) {
+    p.Sources = append(p.Sources, &SourceInstance{name, order, s})
+}
+
+// Changes the order of a Source, overriding the registered one.
+func (p *Processor) SetSourceOrder(name string, order int) {
+    found := false
+    for _, si := range p.Sources {
+        if si.Name == name {
+            logger.Debugf("Setting %s order to %d\n", name, order)
+            si.Order = order
+            found = true
+        }
+    }
+    if !found {
+        logger.Panicf("Source %s not registred", name)
+    }
+
+    sort.SliceStable(p.Sources, func(i, j int) bool {
+        return p.Sources[i].Order < p.Sources[j].Order
+    })
 }
 
 func (p *Processor) Get(name string) SourceInterface {
@@ -432,11 +748,39 @@ func (p *Processor) Get(name string) SourceInterface {
 // Unknow source names are reported and skipped.
 func (p *Processor) MergeConfig(origin string, config util.AnyMap) {
     logger.Debugf("Merging %s\n", origin)
+
+    // Before any vars are loaded and logged
+    if c, exists := config["sensitive"]; exists {
+        MergeSensitiveConfig(c)
+    }
+
     for name, c := range config {
         switch name {
+            case "sensitive":
             case "default_environment":
                 p.DefaultEnvironment = c.(string)
                 logger.Debugf("Setting DefaultEnvironment to %s\n", p.DefaultEnvironment)
+            case "environment_from_env":
+                p.EnvironmentFromEnv = c.(string)
+                logger.Debugf("Setting EnvironmentFromEnv to %s\n", p.EnvironmentFromEnv)
+            case "environment_rules":
+                logger.Debugln("Adding environment rules")
+                p.EnvironmentRules = append(p.EnvironmentRules, MakeEnvironmentRules(c)...)
+            case "source_order":
+                for name, order := range c.(util.AnyMap) {
+                    p.SetSourceOrder(name, order.(int))
+                }
+            case "after_run":
+                logger.Debugln("Adding after_run hooks")
+                p.AfterRun = append(p.AfterRun, MakeHooks(c)...)
+            case "supervise":
+                logger.Debugln("Merging supervise config")
+                p.Supervise.Merge(c.(util.AnyMap))
+            case "readable_dirs":
+                for _, d := range c.([]interface{}) {
+                    logger.Debugf("Adding readable dir %s\n", d)
+                    p.ReadableDirs = append(p.ReadableDirs, util.ToString(d))
+                }
             default:
                 si := p.Get(name)
                 if si == nil {
@@ -448,24 +792,54 @@ func (p *Processor) MergeConfig(origin string, config util.AnyMap) {
     }
 }
 
-// Return the corresponding set of Specs for an environment.
-// Hierarchically overlays Specs from the Sources according to their order.
-func (p *Processor) Specs(environment string) Specs {
+// Environment stack layers, ie "base,prod,prod-eu" - base, prod, prod-eu
+func EnvironmentStack(environment string) []string {
+    return strings.Split(environment, EnvironmentStackSeparator)
+}
+// The last layer of an environment stack
+func StackTopEnvironment(environment string) string {
+    stack := EnvironmentStack(environment)
+    return stack[len(stack) - 1]
+}
+
+// Hierarchically overlays Deployables from the Sources according to their order.
+// For environment stacks, each Source overlays its layers in order.
+// Sources that give the same Deployables for all layers are applied once.
+func (p *Processor) deployables(environment string) *Deployables {
     deployables := &Deployables{nil, make(Specs)}
 
     logger.Debugf("Getting deployables and default vars for %s\n", environment)
+    stack := EnvironmentStack(environment)
     for _, si := range p.Sources {
         logger.Debugf("From %s\n", si.Name)
 
-        d := si.DeployablesForEnvironment(environment)
-        if d != nil {
-            deployables.Overlay(d)
+        var applied *Deployables
+        for _, e := range stack {
+            d := si.DeployablesForEnvironment(e)
+            if d != nil && d != applied {
+                deployables.Overlay(d)
+                applied = d
+            }
         }
     }
+    return deployables
+}
+// Return the corresponding set of Specs for an environment.
+func (p *Processor) Specs(environment string) Specs {
+    deployables := p.deployables(environment)
     logger.Debugln("Filling missing vars from defaults")
 
     return deployables.PreparedSpecs()
 }
+// Resolved global vars for environment
+func (p *Processor) Vars(environment string) Vars {
+    vars := make(Vars)
+    vars.Merge(p.deployables(environment).Vars)
+    if _, exists := vars["environment"]; !exists {
+        vars["environment"] = StackTopEnvironment(environment)
+    }
+    return vars
+}
 
 // List all templates known to the Sources
 func (p *Processor) ListTemplates() []map[string]string {
@@ -484,14 +858,25 @@ func (p *Processor) ListTemplates() []map[string]string {
     return tss
 }
 
-// Find the template by its name
+// Find the template by its name.
+// Template is given file functions restricted to ReadableDirs, and no
+// HostFuncs if NoHostFunctions.
 func (p *Processor) Template(name string) *Template {
     logger.Debugf("Getting template for %s\n", name)
     last_si := len(p.Sources) - 1
     for i := last_si; i >= 0; i-- {
         si := p.Sources[i]
         if t := si.Template(name); t != nil {
-            return t
+            t_p := *t
+            t_p.Funcs = make(template.FuncMap)
+            for n, f := range t.Funcs {
+                t_p.Funcs[n] = f
+            }
+            for n, f := range p.ReadableDirs.FuncMap() {
+                t_p.Funcs[n] = f
+            }
+            t_p.NoHostFuncs = p.NoHostFunctions
+            return &t_p
         }
     }
     return nil
@@ -516,9 +901,15 @@ func (p *Processor) ListEnvironments() []string {
 }
 
 // Process Templates for a given environment.
+// Environment can be a stack, environment var is set to the last layer.
 // Deliver files to the target_base_dir if specified.
-// Templates are processed in parallel.
-func (p *Processor) RunForEnvironment(environment string, target_base_dir string) {
+// Templates are processed in parallel, after_run hooks run at the end.
+// Deploy errors are fatal, hook errors are reported in the result.
+func (p *Processor) RunForEnvironment(environment string, target_base_dir string) *RunResult {
+    return p.RunSpecsForEnvironment(environment, target_base_dir, nil)
+}
+// RunForEnvironment for named Specs only, all if names is nil
+func (p *Processor) RunSpecsForEnvironment(environment string, target_base_dir string, names []string) *RunResult {
     specs := p.Specs(environment)
     if len(specs) == 0 {
         if environment == "" {
@@ -526,46 +917,66 @@ func (p *Processor) RunForEnvironment(environment string, target_base_dir string
         }
         logger.Panicf("Nothing to do for environment %s", environment)
     }
-
-    var wg sync.WaitGroup
-    error_ch := make(chan string)
-    var errs []string
-    go func() {
-        for err:= range error_ch {
-            errs = append(errs, err)
+    if names != nil {
+        named := make(Specs)
+        for _, n := range names {
+            if s, exists := specs[n]; exists {
+                named[n] = s
+            }
         }
-    }()
+        specs = named
+    }
 
+    result := RunResult{Environment: environment}
+    var wg sync.WaitGroup
     for n, s := range specs {
         if _, exists := s.Vars["environment"]; !exists {
-            s.Vars["environment"] = environment
+            s.Vars["environment"] = StackTopEnvironment(environment)
         }
 
         wg.Add(1)
         // Need to pass params, cause loop params are volatile.
         go func(name string, s *Spec) {
+            // Done last, so errors are in before Wait returns
+            defer wg.Done()
             defer func() {
-                wg.Done()
-
                 if r := recover(); r != nil {
-                    error_ch <- fmt.Sprintf("%s", r)
+                    result.add(nil, []string{fmt.Sprintf("%s", r)}, nil)
                 }
             }()
 
+            if reason := s.skipReason(p.NoHostFunctions); reason != "" {
+                logger.Printf("Skipping %s, %s\n", name, reason)
+                result.skip(name + ": " + reason)
+                return
+            }
+
             t := p.Template(name)
+            if s.Format != "" {
+                t = s.FormatTemplate()
+            }
             if t == nil {
                 logger.Panicf("No template for %s", name)
             }
 
             logger.Printf("Deploying %s\n", name)
-            s.Deploy(t, target_base_dir)
+            r := s.Deploy(t, target_base_dir)
+            r.Name = name
+            result.add(r, nil, s.RunHooks(r, environment))
         }(n, s)
     }
     wg.Wait()
+    result.sort()
+
+    if result.Errors != nil {
+        logger.Panicf("%#v", result.Errors)
+    }
 
-    if errs != nil {
-        logger.Panicf("%#v", errs)
+    p.runAfterRunHooks(&result)
+    for _, err := range result.HookErrors {
+        logger.Printf("%s\n", err)
     }
+    return &result
 }
 
 var registered_sources = make(RegisteredSources)
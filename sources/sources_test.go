@@ -1,6 +1,7 @@
 package sources
 
 import (
+    "bytes"
     "os"
     "os/user"
     "syscall"
@@ -160,6 +161,40 @@ func Test_merge_vars(t *testing.T) {
     assert.Equal(t, merged_vars, vr, "merge_vars()")
 }
 
+// Config vars are taken as they are, only external vars maps are flattened
+func Test_MakeVarsNotFlattened(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    config := util.AnyMap{"list": []interface{}{"a", "b"}, "m": util.AnyMap{"k": "v"}}
+    assert.Equal(t, Vars{"list": "[a b]", "m": "map[k:v]"}, MakeVars(config), "config vars")
+
+    var out bytes.Buffer
+    t1 := Template{Content: "{{.list}} {{.m}}"}
+    t1.Write(&out, MakeVars(config))
+    assert.Equal(t, "[a b] map[k:v]", out.String(), "list and map vars in templates")
+
+    d := MakeDeployables(AsDeployablesMap(util.AnyMap{"db": util.AnyMap{"host": "dbhost", "replicas": []interface{}{"r1"}}}))
+    assert.Equal(t, Vars{"db.host": "dbhost", "db.replicas.0": "r1"}, d.Vars, "external vars flattened")
+}
+
+func Test_ExportEnv(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    p := NewProcessor()
+    p.MergeConfig("test", util.AnyMap{
+        "defaults": util.AnyMap{
+            GlobalVarsKey: util.AnyMap{"db.host": "dbhost", "a": "a_default"},
+        },
+        "environments": util.AnyMap{
+            "prod": util.AnyMap{GlobalVarsKey: util.AnyMap{"a": "a_prod"}},
+        },
+    })
+    vars := p.Vars("prod")
+    assert.Equal(t, Vars{"db.host": "dbhost", "a": "a_prod", "environment": "prod"}, vars, "resolved vars")
+    assert.Equal(t, []string{"DB_HOST=dbhost", "APP_A=a_prod"}, vars.ExportEnv([]string{"db.host", "a=APP_A"}), "ExportEnv()")
+    assert.Panics(t, func() { vars.ExportEnv([]string{"b"}) }, "missing var")
+}
+
 func Test_chown(t *testing.T) {
     t.Cleanup(util.SupressLogForTest(t, logger))
 
@@ -213,6 +248,15 @@ var function_tests = map[string]struct{
             "var0": "var0",
         }, `
 var0`,
+    },
+    "subtree": {`
+{{toJson (subtree "db")}}`,
+        Vars{
+            "db.host": "h",
+            "db.replica.host": "r",
+            "dbx": "x",
+        }, `
+{"host":"h","replica":{"host":"r"}}`,
     },
     "sequence+strtoi": {`
 {{range sequence 0 (strtoi "2") -}}
@@ -294,6 +338,42 @@ This cannot exist
 This must exist`,
     },
 }
+var format_tests = map[string]string{
+    "json": `{
+  "host": "h",
+  "port": 80
+}
+`,
+    "yaml": `host: h
+port: 80
+`,
+    "toml": `host = "h"
+port = 80
+`,
+    "ini": `host = h
+port = 80
+`,
+    "shell": `host="h"
+port="80"
+`,
+}
+func Test_FormatTemplate(t *testing.T) {
+    v := Vars{
+        "app.host": "h",
+        "app.port": "80",
+        "other": "o",
+    }
+    for format, expected := range format_tests {
+        s := &Spec{Format: format, Subtree: "app"}
+
+        out := new(strings.Builder)
+        s.FormatTemplate().Write(out, v)
+        assert.Equal(t, expected, out.String(), format + " format")
+    }
+
+    assert.Panics(t, func() { (&Spec{Format: "xml"}).FormatTemplate() }, "unknown format")
+}
+
 func Test_functions(t *testing.T) {
     t.Cleanup(util.SupressLogForTest(t, logger))
 
@@ -305,3 +385,38 @@ func Test_functions(t *testing.T) {
         assert.Equal(t, test.out, out.String(), fn + " function")
     }
 }
+
+func Test_EnvironmentStack(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    p := NewProcessor()
+    p.MergeConfig("test", util.AnyMap{
+        "defaults": util.AnyMap{
+            GlobalVarsKey: util.AnyMap{"a": "a_default", "b": "b_default", "c": "c_default"},
+            "t1": util.AnyMap{"target": "t1", "format": "env", "vars": util.AnyMap{"t": "t_default"}},
+        },
+        "environments": util.AnyMap{
+            "base": util.AnyMap{
+                GlobalVarsKey: util.AnyMap{"a": "a_base", "b": "b_base"},
+                "t1": util.AnyMap{"vars": util.AnyMap{"t": "t_base"}},
+            },
+            "prod": util.AnyMap{
+                GlobalVarsKey: util.AnyMap{"b": "b_prod"},
+                "t2": util.AnyMap{"target": "t2", "format": "env"},
+            },
+        },
+    })
+
+    specs := p.Specs("base,prod")
+    assert.Equal(t, []string{"base", "prod"}, EnvironmentStack("base,prod"), "EnvironmentStack()")
+    assert.Equal(t, "prod", StackTopEnvironment("base,prod"), "StackTopEnvironment()")
+    assert.Equal(t, 2, len(specs), "specs from all layers")
+    assert.Equal(t, Vars{"a": "a_base", "b": "b_prod", "c": "c_default", "t": "t_base"}, specs["t1"].Vars, "t1 vars")
+    assert.Equal(t, Vars{"a": "a_base", "b": "b_prod", "c": "c_default"}, specs["t2"].Vars, "t2 vars")
+    assert.Equal(t, "prod", p.Vars("base,prod")["environment"], "environment var")
+
+    dir := t.TempDir()
+    result := p.RunForEnvironment("prod,base", dir)
+    assert.Equal(t, "prod,base", result.Environment, "result environment")
+    assert.Equal(t, 2, len(result.Deployed), "deployed from all layers")
+}
@@ -0,0 +1,99 @@
+// Supervise mode config, and paths to watch for changes
+
+package sources
+
+import (
+    "strings"
+    "syscall"
+    "time"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+const (
+    DefaultSuperviseInterval = 5 * time.Minute
+    DefaultSupervisePoll     = 2 * time.Second
+)
+
+// Signals by name, for config
+var SignalNames = map[string]syscall.Signal{
+    "HUP":   syscall.SIGHUP,
+    "INT":   syscall.SIGINT,
+    "QUIT":  syscall.SIGQUIT,
+    "TERM":  syscall.SIGTERM,
+    "USR1":  syscall.SIGUSR1,
+    "USR2":  syscall.SIGUSR2,
+    "WINCH": syscall.SIGWINCH,
+}
+// Signal from a name (HUP or SIGHUP) or a number
+func ParseSignal(v interface{}) syscall.Signal {
+    if n, is_int := v.(int); is_int {
+        return syscall.Signal(n)
+    }
+    name := strings.TrimPrefix(strings.ToUpper(util.ToString(v)), "SIG")
+    sig, exists := SignalNames[name]
+    if !exists {
+        logger.Panicf("Unknown signal %v", v)
+    }
+    return sig
+}
+
+// How supervise mode re-renders and tells the child.
+// Targets are re-rendered every Interval, and when watched paths change
+// (checked every Poll). On changes the child gets Signal, or is restarted.
+type SuperviseConfig struct {
+    Interval time.Duration
+    Poll     time.Duration
+    Signal   syscall.Signal
+    Restart  bool
+}
+func (sc *SuperviseConfig) Merge(c util.AnyMap) {
+    if v, exists := c["interval"]; exists {
+        sc.Interval = util.ToDuration(v)
+    }
+    if v, exists := c["poll"]; exists {
+        sc.Poll = util.ToDuration(v)
+    }
+    if v, exists := c["signal"]; exists {
+        sc.Signal = ParseSignal(v)
+    }
+    if v, exists := c["restart"]; exists {
+        sc.Restart = v.(bool)
+    }
+}
+func MakeSuperviseConfig() *SuperviseConfig {
+    return &SuperviseConfig{
+        Interval: DefaultSuperviseInterval,
+        Poll:     DefaultSupervisePoll,
+        Signal:   syscall.SIGHUP,
+    }
+}
+
+// Sources that load local files tell which
+type WatchedPathsSource interface {
+    WatchedPaths() []string
+}
+
+// Paths the Sources loaded from
+func (p *Processor) WatchedPaths() []string {
+    var paths []string
+    for _, si := range p.Sources {
+        if ws, is_watched := si.SourceInterface.(WatchedPathsSource); is_watched {
+            paths = append(paths, ws.WatchedPaths()...)
+        }
+    }
+    return paths
+}
+
+func (v *VarsFilesSource) WatchedPaths() []string {
+    return v.Paths
+}
+func (s *SecretsDirSource) WatchedPaths() []string {
+    return s.Paths
+}
+func (k *KubernetesSource) WatchedPaths() []string {
+    if !k.Enabled || k.Dir == "" {
+        return nil
+    }
+    return []string{k.Dir}
+}
@@ -59,7 +59,7 @@ func FindEnvVarsPrefix (dir string) EnvForPrefix {
     if _, err := os.Stat(config_path); err == nil {
         config := LoadConfigFile(config_path)
         if prefix, exists := config["env_vars_prefix"]; exists {
-            env_vars_prefix = prefix.(string)
+            env_vars_prefix = EnvVarsPrefixes(prefix)[0].Prefix
         }
     }
 
@@ -68,7 +68,7 @@ func FindEnvVarsPrefix (dir string) EnvForPrefix {
         for _, m := range matches {
             config := LoadConfigFile(m)
             if prefix, exists := config["env_vars_prefix"]; exists {
-                env_vars_prefix = prefix.(string)
+                env_vars_prefix = EnvVarsPrefixes(prefix)[0].Prefix
             }
         }
     }
@@ -121,16 +121,16 @@ func DumpVarsChain(p *Processor, environment string, tpl string) VarsChain {
 
     for _, si := range p.Sources {
         ds := si.DeployablesForEnvironment(environment)
-        v := ds.Vars
+        if ds == nil {
+            continue
+        }
 
-        if v != nil {
+        if v := ds.Vars; v != nil {
             vc.append(si.Name + " vars", v)
         }
 
-        if ds != nil {
-            if t, exists := ds.Specs[tpl]; exists {
-                vc.append(si.Name, t.Vars)
-            }
+        if t, exists := ds.Specs[tpl]; exists {
+            vc.append(si.Name, t.Vars)
         }
     }
 
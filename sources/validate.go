@@ -0,0 +1,58 @@
+// Pre-deploy validation of rendered targets
+
+package sources
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+// A validate command, config as for hooks. %s in the command is replaced
+// with the rendered file path. If there is no %s the path is appended.
+type Validator struct {
+    Hook
+}
+func MakeValidator(c interface{}) *Validator {
+    v := Validator{*MakeHook(c)}
+    if !strings.Contains(strings.Join(v.Args, " "), "%s") {
+        if v.isShell() {
+            v.Args[2] += " %s"
+        } else {
+            v.Args = append(v.Args, "%s")
+        }
+    }
+    return &v
+}
+
+func (v *Validator) isShell() bool {
+    return len(v.Args) == 3 && v.Args[0] == "/bin/sh" && v.Args[1] == "-c"
+}
+
+// Command args for path. Path is quoted for sh -c commands.
+func (v *Validator) argsFor(path string) []string {
+    args := make([]string, len(v.Args))
+    copy(args, v.Args)
+    if v.isShell() {
+        args[2] = strings.Replace(args[2], "%s", util.ShellQuote(path), -1)
+    } else {
+        for i, a := range args {
+            args[i] = strings.Replace(a, "%s", path, -1)
+        }
+    }
+    return args
+}
+
+// Runs the command against path.
+// Returns an error with the command output on failure.
+func (v *Validator) Validate(path string) error {
+    args := v.argsFor(path)
+    logger.Debugf("Validating %s\n", path)
+    stdout, stderr, err := util.RunCommand(args, nil, v.Timeout)
+    if err != nil {
+        output := strings.TrimSpace(string(stdout) + "\n" + string(stderr))
+        return fmt.Errorf("Validate %s failed: %s %s", &v.Hook, err, output)
+    }
+    return nil
+}
@@ -0,0 +1,82 @@
+package sources
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+func Test_Validate(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    v := MakeValidator("nginx -t -c %s")
+    assert.Equal(t, []string{"/bin/sh", "-c", `nginx -t -c "/etc/my conf"`}, v.argsFor("/etc/my conf"), "shell command")
+    v = MakeValidator([]interface{}{"php", "-l"})
+    assert.Equal(t, []string{"php", "-l", "/x.php"}, v.argsFor("/x.php"), "args, path appended")
+
+    dir := t.TempDir()
+    target := filepath.Join(dir, "t1.json")
+    p := NewProcessor()
+    p.MergeConfig("test", util.AnyMap{
+        "defaults": util.AnyMap{
+            "t1.json": util.AnyMap{
+                "target": "t1.json",
+                "format": "json",
+                "vars": util.AnyMap{"a": "good"},
+                "validate": util.AnyMap{
+                    "command": "case %s in *.json) grep -q good %s ;; *) false ;; esac || { echo invalid; exit 1; }",
+                    "timeout": "5s",
+                },
+            },
+        },
+    })
+
+    result := p.RunForEnvironment("prod", dir)
+    assert.Equal(t, []string{target}, result.ChangedTargets(), "valid target deployed")
+    valid := util.SlurpFile(target)
+
+    p.MergeConfig("test", util.AnyMap{"defaults": util.AnyMap{"t1.json": util.AnyMap{"vars": util.AnyMap{"a": "bad"}}}})
+    func() {
+        defer func() {
+            r := recover()
+            assert.NotNil(t, r, "invalid target")
+            assert.Contains(t, r, "invalid", "validate output")
+        }()
+        p.RunForEnvironment("prod", dir)
+    }()
+    assert.Equal(t, valid, util.SlurpFile(target), "invalid target not deployed")
+
+    entries := util.ReadDir(dir)
+    assert.Equal(t, 1, len(entries), "temp file removed")
+    assert.False(t, strings.HasPrefix(entries[0].Name(), "."), "temp file removed")
+
+    // Replaced by rename, keeping the mode, symlinks are followed
+    real_target := filepath.Join(dir, "real.json")
+    assert.Nil(t, os.Rename(target, real_target))
+    assert.Nil(t, os.Chmod(real_target, 0640))
+    assert.Nil(t, os.Symlink("real.json", target))
+    p.MergeConfig("test", util.AnyMap{"defaults": util.AnyMap{"t1.json": util.AnyMap{"vars": util.AnyMap{"a": "good again"}}}})
+    p.RunForEnvironment("prod", dir)
+    assert.Contains(t, string(util.SlurpFile(real_target)), "good again", "symlinked target deployed")
+    stat, err := os.Lstat(target)
+    assert.Nil(t, err)
+    assert.NotZero(t, stat.Mode() & os.ModeSymlink, "symlink kept")
+    stat, err = os.Stat(real_target)
+    assert.Nil(t, err)
+    assert.Equal(t, os.FileMode(0640), stat.Mode().Perm(), "mode kept")
+
+    // Validator sees the configured perms
+    mode_file := filepath.Join(t.TempDir(), "mode")
+    p.MergeConfig("test", util.AnyMap{"defaults": util.AnyMap{"secret.json": util.AnyMap{
+        "target": "secret.json",
+        "format": "json",
+        "perms": 0600,
+        "validate": "stat -c %a %s > " + mode_file,
+    }}})
+    p.RunForEnvironment("prod", dir)
+    assert.Equal(t, "600\n", string(util.SlurpFile(mode_file)), "validated file perms")
+}
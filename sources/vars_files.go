@@ -0,0 +1,114 @@
+// Infrastructure for vars files - JSON, YAML, TOML and dotenv files
+// dropped in by the platform
+
+package sources
+
+import (
+    "bytes"
+    "encoding/json"
+    "path/filepath"
+    "strings"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+// Parses vars in format json, yaml, toml or env.
+func ParseVars(data []byte, format string, origin string) util.AnyMap {
+    vars := make(util.AnyMap)
+    switch format {
+        case "json":
+            dec := json.NewDecoder(bytes.NewReader(data))
+            dec.UseNumber()
+            if err := dec.Decode(&vars); err != nil {
+                logger.Panicf("%s: %s", origin, err)
+            }
+        case "yaml", "yml":
+            util.ParseYaml(data, vars)
+        case "toml":
+            vars = util.ParseToml(data)
+        case "env":
+            for n, v := range util.ParseDotEnv(data) {
+                vars[n] = v
+            }
+        default:
+            logger.Panicf("%s: unknown vars format %s", origin, format)
+    }
+    return vars
+}
+
+// Loads a vars file into a deployables map.
+// Format is derived from the file extension if not specified.
+// If the file has a _vars key, it is taken as Templates structure,
+// otherwise as a (possibly nested) set of global vars.
+func LoadVarsFile(path string, format string) util.AnyMap {
+    if format == "" {
+        format = strings.TrimPrefix(filepath.Ext(path), ".")
+    }
+
+    return AsDeployablesMap(ParseVars(util.SlurpFile(path), format, path))
+}
+
+// A vars files version of DeployablesSource type.
+// Paths holds loaded files.
+type VarsFilesSource struct {
+    *DeployablesSource
+    Paths []string
+}
+// Config is a list of paths (globs), or maps with path, optional and format keys.
+// Missing files are fatal unless optional.
+func (v *VarsFilesSource) MergeConfig(origin string, files interface{}) {
+    var entries []interface{}
+    switch f := files.(type) {
+        case string:
+            entries = []interface{}{f}
+        case []interface{}:
+            entries = f
+        default:
+            logger.Panicf("%s: vars_files must be a list", origin)
+    }
+
+    for _, e := range entries {
+        var (
+            path     string
+            format   string
+            optional bool
+        )
+        switch e_t := e.(type) {
+            case string:
+                path = e_t
+            case util.AnyMap:
+                path = util.ToString(e_t["path"])
+                format = util.ToString(e_t["format"])
+                optional, _ = e_t["optional"].(bool)
+            default:
+                logger.Panicf("%s: invalid vars_files entry %v", origin, e)
+        }
+
+        matches, err := filepath.Glob(path)
+        if err != nil {
+            panic(err)
+        }
+        if len(matches) == 0 {
+            if optional {
+                logger.Debugf("Optional vars file %s not found\n", path)
+                continue
+            }
+            logger.Panicf("Vars file %s not found", path)
+        }
+
+        for _, m := range matches {
+            logger.Debugf("Loading vars file %s\n", m)
+            v.Paths = append(v.Paths, m)
+            v.DeployablesSource.MergeConfig(origin + " vars_files " + m, LoadVarsFile(m, format))
+        }
+    }
+}
+
+func MakeVarsFilesSource() SourceInterface {
+    ds := MakeDeployablesSource()
+    return &VarsFilesSource{ds.(*DeployablesSource), nil}
+}
+
+func init() {
+    RegisterSource("vars_files", MakeVarsFilesSource, 70, false)
+}
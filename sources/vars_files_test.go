@@ -0,0 +1,99 @@
+package sources
+
+import (
+    "path/filepath"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+var vars_files = map[string]string{
+    "runtime.json": `{"a": "json", "port": 8080, "db": {"host": "dbhost", "replicas": ["r1", "r2"]}}`,
+    "runtime.yaml": `
+b: yaml
+db:
+    name: dbname
+`,
+    "runtime.toml": `
+# comment
+c = "toml" # comment
+big = 1_000
+[db]
+user = 'dbuser'
+[db."x.y"]
+z = [1, "two", true]
+`,
+    "runtime.env": `
+# comment
+export d=env
+e="quoted \"value\""
+f='single'
+g=unquoted # comment
+`,
+    "deployables.yaml": `
+_vars:
+    h: deployables
+t1.conf:
+    vars:
+        i: template
+`,
+}
+
+func Test_VarsFilesSource(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    dir := t.TempDir()
+    for name, content := range vars_files {
+        util.WriteFile(filepath.Join(dir, name), []byte(content))
+    }
+
+    vfs := MakeVarsFilesSource()
+    vfs.MergeConfig("test", []interface{}{
+        filepath.Join(dir, "runtime.*"),
+        filepath.Join(dir, "deployables.yaml"),
+        util.AnyMap{"path": filepath.Join(dir, "missing.json"), "optional": true},
+    })
+
+    d := vfs.DeployablesForEnvironment("")
+    assert.Equal(t, Vars{
+        "a": "json",
+        "port": "8080",
+        "db.host": "dbhost",
+        "db.replicas.0": "r1",
+        "db.replicas.1": "r2",
+        "b": "yaml",
+        "db.name": "dbname",
+        "c": "toml",
+        "big": "1000",
+        "db.user": "dbuser",
+        "db.x.y.z.0": "1",
+        "db.x.y.z.1": "two",
+        "db.x.y.z.2": "true",
+        "d": "env",
+        "e": `quoted "value"`,
+        "f": "single",
+        "g": "unquoted",
+        "h": "deployables",
+    }, d.Vars, "vars_files vars")
+    assert.Equal(t, Vars{"i": "template"}, d.Specs["t1.conf"].Vars, "vars_files template vars")
+
+    assert.Equal(t, 5, len(vfs.(*VarsFilesSource).Paths), "vars_files loaded paths")
+
+    assert.Panics(t, func() {
+        MakeVarsFilesSource().MergeConfig("test", filepath.Join(dir, "missing.json"))
+    }, "missing required vars file")
+}
+
+func Test_SetSourceOrder(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    p := NewProcessor()
+    p.MergeConfig("test", util.AnyMap{"source_order": util.AnyMap{"vars_files": 200}})
+
+    last := p.Sources[len(p.Sources) - 1]
+    assert.Equal(t, "vars_files", last.Name, "last source")
+    assert.Equal(t, 200, last.Order, "last source order")
+
+    assert.Panics(t, func() { p.SetSourceOrder("nonexist", 1) }, "unknown source order")
+}
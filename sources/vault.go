@@ -0,0 +1,257 @@
+// Infrastructure for HashiCorp Vault KV secrets
+
+package sources
+
+import (
+    "os"
+    "strings"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+// Vault auth options. Method is one of token (default), token_file, approle.
+type VaultAuth struct {
+    Method       string
+    Token        string
+    TokenFile    string
+    Mount        string
+    RoleID       string
+    RoleIDFile   string
+    SecretID     string
+    SecretIDFile string
+}
+func (a *VaultAuth) Merge(m util.AnyMap) {
+    fields := map[string]*string{
+        "method":         &a.Method,
+        "token":          &a.Token,
+        "token_file":     &a.TokenFile,
+        "mount":          &a.Mount,
+        "role_id":        &a.RoleID,
+        "role_id_file":   &a.RoleIDFile,
+        "secret_id":      &a.SecretID,
+        "secret_id_file": &a.SecretIDFile,
+    }
+    for k, f := range fields {
+        if v, exists := m[k]; exists {
+            *f = util.ToString(v)
+        }
+    }
+}
+
+// Value from a literal or a file
+func valueOrFile(v string, path string) string {
+    if v == "" && path != "" {
+        return strings.TrimSpace(string(util.SlurpFile(path)))
+    }
+    return v
+}
+
+// A secret path to vars mapping.
+// Path can contain {{environment}}. If Template is set, vars go to the
+// template vars, otherwise to global vars. Keys maps secret keys to var names,
+// if not set all secret keys are taken, with Prefix.
+type VaultSecret struct {
+    Path     string
+    Template string
+    Keys     map[string]string
+    Prefix   string
+    Optional bool
+}
+func MakeVaultSecret(m util.AnyMap) *VaultSecret {
+    s := VaultSecret{
+        Path:     util.ToString(m["path"]),
+        Template: util.ToString(m["template"]),
+        Prefix:   util.ToString(m["prefix"]),
+    }
+    if s.Path == "" {
+        logger.Panicf("Vault secret without path %v", m)
+    }
+    if keys, exists := m["keys"]; exists {
+        s.Keys = make(map[string]string)
+        for k, v := range keys.(util.AnyMap) {
+            s.Keys[k] = util.ToString(v)
+        }
+    }
+    s.Optional, _ = m["optional"].(bool)
+    return &s
+}
+
+// Secret data to flat vars
+func (s *VaultSecret) Vars(data util.AnyMap) util.AnyMap {
+    selected := make(util.AnyMap)
+    if s.Keys != nil {
+        for k, var_name := range s.Keys {
+            v, exists := data[k]
+            if !exists {
+                logger.Panicf("Vault secret %s has no key %s", s.Path, k)
+            }
+            selected[var_name] = v
+        }
+    } else {
+        for k, v := range data {
+            selected[s.Prefix + k] = v
+        }
+    }
+    return util.Flatten(selected, SubtreeSeparator)
+}
+
+// Vault KV Source. Secrets are fetched per environment, when needed.
+// All vars are marked sensitive.
+type VaultSource struct {
+    Address   string
+    Namespace string
+    KVVersion int
+    Auth      VaultAuth
+    HTTP      *util.HTTPClientConfig
+    Secrets   []*VaultSecret
+
+    token                  string
+    EnvironmentDeployables
+    BaseSource
+}
+func (v *VaultSource) MergeConfig(origin string, c interface{}) {
+    c_m := c.(util.AnyMap)
+    v.AddHistory(origin, c_m)
+
+    if a, exists := c_m["address"]; exists {
+        v.Address = strings.TrimSuffix(util.ToString(a), "/")
+    }
+    if ns, exists := c_m["namespace"]; exists {
+        v.Namespace = util.ToString(ns)
+    }
+    if kv, exists := c_m["kv_version"]; exists {
+        v.KVVersion = kv.(int)
+    }
+    if a, exists := c_m["auth"]; exists {
+        v.Auth.Merge(a.(util.AnyMap))
+    }
+    v.HTTP.Merge(c_m)
+    if ss, exists := c_m["secrets"]; exists {
+        for _, s := range ss.([]interface{}) {
+            v.Secrets = append(v.Secrets, MakeVaultSecret(s.(util.AnyMap)))
+        }
+    }
+}
+
+func (v *VaultSource) headers() map[string]string {
+    h := make(map[string]string)
+    if v.Namespace != "" {
+        h["X-Vault-Namespace"] = v.Namespace
+    }
+    if v.token != "" {
+        h["X-Vault-Token"] = v.token
+    }
+    return h
+}
+
+func (v *VaultSource) login() {
+    if v.token != "" {
+        return
+    }
+
+    switch v.Auth.Method {
+        case "", "token":
+            v.token = v.Auth.Token
+            if v.token == "" {
+                v.token = os.Getenv("VAULT_TOKEN")
+            }
+        case "token_file":
+            v.token = valueOrFile("", v.Auth.TokenFile)
+        case "approle":
+            mount := v.Auth.Mount
+            if mount == "" {
+                mount = "approle"
+            }
+            login := map[string]string{
+                "role_id":   valueOrFile(v.Auth.RoleID, v.Auth.RoleIDFile),
+                "secret_id": valueOrFile(v.Auth.SecretID, v.Auth.SecretIDFile),
+            }
+            var resp struct {
+                Auth struct {
+                    ClientToken string `json:"client_token"`
+                } `json:"auth"`
+            }
+            url := v.Address + "/v1/auth/" + mount + "/login"
+            logger.Debugf("Vault AppRole login %s\n", url)
+            if err := util.HTTPRequestJSON(v.HTTP.Client(), "POST", url, v.headers(), login, &resp); err != nil {
+                panic(err)
+            }
+            v.token = resp.Auth.ClientToken
+        default:
+            logger.Panicf("Unknown Vault auth method %s", v.Auth.Method)
+    }
+
+    if v.token == "" {
+        logger.Panic("No Vault token")
+    }
+}
+
+// Reads secret data from path. Returns nil if the secret does not exist.
+func (v *VaultSource) Read(path string) util.AnyMap {
+    v.login()
+
+    url := v.Address + "/v1/" + strings.TrimPrefix(path, "/")
+    logger.Debugf("Reading Vault secret %s\n", url)
+
+    var resp struct {
+        Data util.AnyMap `json:"data"`
+    }
+    if err := util.HTTPRequestJSON(v.HTTP.Client(), "GET", url, v.headers(), nil, &resp); err != nil {
+        if se, ok := err.(*util.HTTPStatusError); ok && se.StatusCode == 404 {
+            return nil
+        }
+        panic(err)
+    }
+
+    if v.KVVersion == 1 {
+        return resp.Data
+    }
+    data, _ := resp.Data["data"].(util.AnyMap)
+    return data
+}
+
+func (v *VaultSource) DeployablesForEnvironment(environment string) *Deployables {
+    if len(v.Secrets) == 0 {
+        return nil
+    }
+    if d, exists := v.EnvironmentDeployables[environment]; exists {
+        return d
+    }
+
+    if v.Address == "" {
+        v.Address = strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+    }
+
+    deployables := make(util.AnyMap)
+    for _, s := range v.Secrets {
+        path := ExpandForEnvironment(s.Path, environment)
+        data := v.Read(path)
+        if data == nil {
+            if s.Optional {
+                logger.Debugf("Optional Vault secret %s not found\n", path)
+                continue
+            }
+            logger.Panicf("Vault secret %s not found", path)
+        }
+
+        vars := s.Vars(data)
+        for n, _ := range vars {
+            MarkSensitive(n)
+        }
+        v.AddHistory("vault " + path, vars)
+
+        MergeVarsInto(deployables, s.Template, vars)
+    }
+
+    d := MakeDeployables(deployables)
+    v.EnvironmentDeployables[environment] = d
+    return d
+}
+
+func MakeVaultSource() SourceInterface {
+    return &VaultSource{KVVersion: 2, HTTP: &util.HTTPClientConfig{}, EnvironmentDeployables: make(EnvironmentDeployables), BaseSource: MakeBaseSource()}
+}
+
+func init() {
+    RegisterSource("vault", MakeVaultSource, 85, false)
+}
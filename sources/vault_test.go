@@ -0,0 +1,107 @@
+package sources
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+const vault_test_token = "s.testtoken"
+
+// Minimal Vault API stand-in: AppRole login, KV v1 and v2 reads
+func vaultTestServer(t *testing.T) *httptest.Server {
+    secrets := map[string]util.AnyMap{
+        "/v1/secret/data/prod/app": {
+            "data": util.AnyMap{"data": util.AnyMap{"db_password": "pr0d", "db": util.AnyMap{"user": "app"}}},
+        },
+        "/v1/secret/data/prod/t1": {
+            "data": util.AnyMap{"data": util.AnyMap{"api_key": "k3y", "ignored": "x"}},
+        },
+        "/v1/kv/prod": {
+            "data": util.AnyMap{"legacy": "v1"},
+        },
+    }
+
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/v1/auth/approle/login" {
+            var login map[string]string
+            json.NewDecoder(r.Body).Decode(&login)
+            if login["role_id"] != "role" || login["secret_id"] != "secret" {
+                http.Error(w, `{"errors":["invalid role or secret ID"]}`, http.StatusBadRequest)
+                return
+            }
+            json.NewEncoder(w).Encode(util.AnyMap{"auth": util.AnyMap{"client_token": vault_test_token}})
+            return
+        }
+
+        if r.Header.Get("X-Vault-Token") != vault_test_token {
+            http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+            return
+        }
+        s, exists := secrets[r.URL.Path]
+        if !exists {
+            http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+            return
+        }
+        json.NewEncoder(w).Encode(s)
+    }))
+}
+
+func Test_VaultSource(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    server := vaultTestServer(t)
+    defer server.Close()
+
+    secret_id_file := filepath.Join(t.TempDir(), "secret_id")
+    util.WriteFile(secret_id_file, []byte("secret\n"))
+
+    vs := MakeVaultSource()
+    vs.MergeConfig("test", util.AnyMap{
+        "address": server.URL + "/",
+        "auth": util.AnyMap{
+            "method": "approle",
+            "role_id": "role",
+            "secret_id_file": secret_id_file,
+        },
+        "secrets": []interface{}{
+            util.AnyMap{"path": "secret/data/{{environment}}/app", "prefix": "vault_"},
+            util.AnyMap{"path": "secret/data/{{environment}}/t1", "template": "t1.conf", "keys": util.AnyMap{"api_key": "key"}},
+            util.AnyMap{"path": "secret/data/{{environment}}/missing", "optional": true},
+        },
+    })
+
+    d := vs.DeployablesForEnvironment("prod")
+    assert.Equal(t, Vars{"vault_db_password": "pr0d", "vault_db.user": "app"}, d.Vars, "vault global vars")
+    assert.Equal(t, Vars{"key": "k3y"}, d.Specs["t1.conf"].Vars, "vault template vars")
+    assert.True(t, IsSensitive("vault_db_password"), "vault var is sensitive")
+    assert.Same(t, d, vs.DeployablesForEnvironment("prod"), "vault deployables cached")
+
+    assert.Panics(t, func() { vs.DeployablesForEnvironment("test") }, "missing required vault secret")
+
+    vs = MakeVaultSource()
+    vs.MergeConfig("test", util.AnyMap{
+        "address": server.URL,
+        "kv_version": 1,
+        "auth": util.AnyMap{"token": vault_test_token},
+        "secrets": []interface{}{util.AnyMap{"path": "kv/{{environment}}"}},
+    })
+    assert.Equal(t, Vars{"legacy": "v1"}, vs.DeployablesForEnvironment("prod").Vars, "vault kv v1 vars")
+
+    vs = MakeVaultSource()
+    vs.MergeConfig("test", util.AnyMap{
+        "address": server.URL,
+        "auth": util.AnyMap{"token": "wrong"},
+        "secrets": []interface{}{util.AnyMap{"path": "kv/prod"}},
+    })
+    assert.PanicsWithError(t, server.URL + `/v1/kv/prod: HTTP status 403 {"errors":["permission denied"]}`, func() {
+        vs.DeployablesForEnvironment("prod")
+    }, "vault permission denied")
+
+    assert.Nil(t, MakeVaultSource().DeployablesForEnvironment("prod"), "vault without secrets")
+}
@@ -0,0 +1,51 @@
+// Conditional Specs - when: expressions and enabled: switch
+
+package sources
+
+import (
+    "bytes"
+    "strings"
+
+    "github.com/catalyst/gotiller/util"
+)
+
+// Template that outputs the when: expression value if it is true,
+// template wise (not false, 0, nil or empty)
+func whenTemplate(expr string, no_host_funcs bool) *Template {
+    expr = strings.TrimSpace(expr)
+    expr = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(expr, "{{"), "}}"))
+    return &Template{Path: "when " + expr, Content: "{{with " + expr + "}}{{.}}{{end}}", NoHostFuncs: no_host_funcs}
+}
+
+// Template truthiness, and vars are strings, so "false", "0" etc
+// (as for strconv.ParseBool) are false too.
+func whenTrue(out string) bool {
+    if out == "" {
+        return false
+    }
+    if b, err := util.ToBool(out); err == nil {
+        return b
+    }
+    return true
+}
+
+// Why the Spec is not to be deployed, "" if it is.
+// Spec is skipped if disabled, or When evaluates false against its Vars.
+func (s *Spec) SkipReason() string {
+    return s.skipReason(false)
+}
+func (s *Spec) skipReason(no_host_funcs bool) string {
+    if s.Enabled != nil && !*s.Enabled {
+        return "disabled"
+    }
+    if s.When == "" {
+        return ""
+    }
+
+    var out bytes.Buffer
+    whenTemplate(s.When, no_host_funcs).Write(&out, s.Vars)
+    if !whenTrue(out.String()) {
+        return "when " + s.When + " is false"
+    }
+    return ""
+}
@@ -0,0 +1,91 @@
+package sources
+
+import (
+    "path/filepath"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+    "github.com/catalyst/gotiller/util"
+)
+
+func Test_When(t *testing.T) {
+    t.Cleanup(util.SupressLogForTest(t, logger))
+
+    p := NewProcessor()
+    p.MergeConfig("test", util.AnyMap{
+        "defaults": util.AnyMap{
+            GlobalVarsKey: util.AnyMap{"cache_backend": "redis"},
+            "redis.conf": util.AnyMap{
+                "target": "redis.conf",
+                "format": "env",
+                "when": `{{ eq .cache_backend "redis" }}`,
+            },
+            "memcached.conf": util.AnyMap{
+                "target": "memcached.conf",
+                "format": "env",
+                "when": `eq .cache_backend "memcached"`,
+            },
+            "debug.conf": util.AnyMap{
+                "target": "debug.conf",
+                "format": "env",
+            },
+        },
+        "environments": util.AnyMap{
+            "prod": util.AnyMap{
+                "debug.conf": util.AnyMap{"enabled": false},
+            },
+        },
+    })
+
+    dir := t.TempDir()
+    result := p.RunForEnvironment("prod", dir)
+    assert.Equal(t, []string{filepath.Join(dir, "redis.conf")}, result.ChangedTargets(), "deployed")
+    assert.Equal(t, []string{
+        "debug.conf: disabled",
+        `memcached.conf: when eq .cache_backend "memcached" is false`,
+    }, result.Skipped, "skipped")
+
+    result = p.RunForEnvironment("dev", t.TempDir())
+    assert.Equal(t, 2, len(result.Deployed), "debug.conf enabled in dev")
+
+    p.MergeConfig("test", util.AnyMap{
+        "environments": util.AnyMap{
+            "prod": util.AnyMap{
+                "debug.conf": util.AnyMap{"enabled": true},
+            },
+        },
+    })
+    result = p.RunForEnvironment("prod", t.TempDir())
+    assert.Equal(t, 2, len(result.Deployed), "debug.conf re-enabled")
+
+    // Var values are strings, "false" and "0" are false
+    p.MergeConfig("test", util.AnyMap{
+        "defaults": util.AnyMap{
+            GlobalVarsKey: util.AnyMap{"use_redis": "false", "use_debug": "1"},
+            "redis.conf": util.AnyMap{"when": ".use_redis"},
+            "debug.conf": util.AnyMap{"when": ".use_debug"},
+        },
+        "environments": util.AnyMap{
+            "prod": util.AnyMap{
+                "debug.conf": util.AnyMap{"enabled": "true"},
+            },
+        },
+    })
+    dir = t.TempDir()
+    result = p.RunForEnvironment("prod", dir)
+    assert.Equal(t, []string{filepath.Join(dir, "debug.conf")}, result.ChangedTargets(), "when var values")
+    for out, expected := range map[string]bool{"": false, "false": false, "0": false, "F": false, "true": true, "1": true, "redis": true, "map[a:b]": true} {
+        assert.Equal(t, expected, whenTrue(out), "when output %q", out)
+    }
+
+    assert.Panics(t, func() {
+        p.MergeConfig("test", util.AnyMap{
+            "environments": util.AnyMap{"prod": util.AnyMap{"debug.conf": util.AnyMap{"enabled": "nope"}}},
+        })
+    }, "invalid enabled")
+
+    p.MergeConfig("test", util.AnyMap{
+        "defaults": util.AnyMap{"redis.conf": util.AnyMap{"when": "{{ eq .no_such_var }}"}},
+    })
+    assert.Panics(t, func() { p.RunForEnvironment("prod", t.TempDir()) }, "invalid when")
+}
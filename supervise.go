@@ -0,0 +1,196 @@
+// Supervise mode - keeps targets up to date for a child process
+
+package gotiller
+
+import (
+    "os"
+    "os/exec"
+    "os/signal"
+    "syscall"
+    "time"
+
+    "github.com/catalyst/gotiller/sources"
+    "github.com/catalyst/gotiller/util"
+)
+
+// Signals passed on to the child
+var ForwardedSignals = []os.Signal{
+    syscall.SIGHUP,
+    syscall.SIGINT,
+    syscall.SIGQUIT,
+    syscall.SIGTERM,
+    syscall.SIGUSR1,
+    syscall.SIGUSR2,
+    syscall.SIGWINCH,
+}
+
+// Runs a child process, re-processing periodically and when watched
+// files change. On changes the child is signalled or restarted, see
+// sources.SuperviseConfig.
+// All exited children are reaped, so it can run as PID 1.
+// Everything happens in the Run loop, so reaping cannot interfere with
+// hooks and exec sources waiting for their commands.
+type Supervisor struct {
+    Dir           string
+    Environment   string
+    TargetBaseDir string
+    Verbose       bool
+    NoHostFuncs   bool
+    Args          []string
+    Export        []string
+
+    processor   *sources.Processor
+    environment string
+    watched     []string
+    state       util.PathsState
+    child       *os.Process
+    restarting  bool
+}
+
+// Processes config. Returns whether any target changed, and whether the run failed.
+// Watched paths state is taken before processing, so changes made
+// meanwhile are picked up by the next poll. It stays if processing fails.
+func (s *Supervisor) process() (bool, bool) {
+    watched := s.watched
+    s.state = util.StatPaths(watched)
+
+    processor, result := ProcessWithResult(s.Dir, s.Environment, s.TargetBaseDir, s.Verbose, s.NoHostFuncs)
+    s.processor = processor
+    s.environment = result.Environment
+    s.watched = append([]string{s.Dir}, processor.WatchedPaths()...)
+    s.state.AddWatched(s.watched, watched)
+    return len(result.ChangedTargets()) > 0, result.Failed()
+}
+
+// Re-processes, failures are logged and the child is left alone
+// until the next change.
+func (s *Supervisor) reprocess() {
+    defer func() {
+        if r := recover(); r != nil {
+            logger.Printf("Processing failed: %v\n", r)
+        }
+    }()
+
+    changed, _ := s.process()
+    if !changed {
+        return
+    }
+
+    config := s.processor.Supervise
+    if config.Restart {
+        logger.Println("Targets changed, restarting")
+        s.restarting = true
+        s.signal(syscall.SIGTERM)
+    } else {
+        logger.Printf("Targets changed, sending %s\n", config.Signal)
+        s.signal(config.Signal)
+    }
+}
+
+func (s *Supervisor) start() {
+    env := os.Environ()
+    if len(s.Export) > 0 {
+        env = util.MergeEnv(env, s.processor.Vars(s.environment).ExportEnv(s.Export))
+    }
+
+    cmd := exec.Command(s.Args[0], s.Args[1:]...)
+    cmd.Env = env
+    cmd.Stdin = os.Stdin
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    if err := cmd.Start(); err != nil {
+        panic(err)
+    }
+    s.child = cmd.Process
+    logger.Printf("Started %v, pid %d\n", s.Args, s.child.Pid)
+}
+
+func (s *Supervisor) signal(sig os.Signal) {
+    if err := s.child.Signal(sig); err != nil {
+        logger.Printf("Cannot send %s to %d: %s\n", sig, s.child.Pid, err)
+    }
+}
+
+// Reaps exited children. Returns the child status if it exited.
+func (s *Supervisor) reap() *syscall.WaitStatus {
+    var child_status *syscall.WaitStatus
+    for {
+        var ws syscall.WaitStatus
+        pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+        if err != nil || pid <= 0 {
+            return child_status
+        }
+        if pid == s.child.Pid {
+            child_status = &ws
+        } else {
+            logger.Debugf("Reaped %d\n", pid)
+        }
+    }
+}
+
+func exitCode(ws *syscall.WaitStatus) int {
+    if ws.Signaled() {
+        return 128 + int(ws.Signal())
+    }
+    return ws.ExitStatus()
+}
+
+// Processes, starts the child and supervises it until it exits.
+// Returns the exit code.
+func (s *Supervisor) Run() int {
+    s.watched = []string{s.Dir}
+    if _, failed := s.process(); failed {
+        return 1
+    }
+
+    sigs := make(chan os.Signal, 8)
+    signal.Notify(sigs, ForwardedSignals...)
+    chld := make(chan os.Signal, 1)
+    signal.Notify(chld, syscall.SIGCHLD)
+    defer signal.Stop(sigs)
+    defer signal.Stop(chld)
+
+    s.start()
+
+    poll := s.processor.Supervise.Poll
+    ticker := time.NewTicker(poll)
+    defer ticker.Stop()
+    last_run := time.Now()
+
+    for {
+        select {
+            case sig := <-sigs:
+                logger.Debugf("Forwarding %s\n", sig)
+                s.signal(sig)
+            case <-chld:
+                ws := s.reap()
+                if ws == nil {
+                    break
+                }
+                if s.restarting {
+                    s.restarting = false
+                    s.start()
+                    break
+                }
+                logger.Printf("%v exited, status %d\n", s.Args, exitCode(ws))
+                return exitCode(ws)
+            case <-ticker.C:
+                config := s.processor.Supervise
+                due := config.Interval > 0 && time.Since(last_run) >= config.Interval
+                if !due {
+                    changed := s.state.Changed(util.StatPaths(s.watched))
+                    if len(changed) == 0 {
+                        break
+                    }
+                    logger.Printf("Changed %v\n", changed)
+                }
+                last_run = time.Now()
+                s.reprocess()
+
+                if p := s.processor.Supervise.Poll; p != poll {
+                    poll = p
+                    ticker.Reset(poll)
+                }
+        }
+    }
+}
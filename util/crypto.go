@@ -0,0 +1,94 @@
+// Utility functions. Authenticated encryption of config values.
+// Values are AES-256-GCM encrypted and wrapped in ENC[AES256_GCM,...]
+// envelopes, with a 32 bytes key. The var name is authenticated along
+// with the value, so a value cannot be moved to another var.
+
+package util
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "strings"
+)
+
+const (
+    EncryptionKeySize = 32
+    encryptedPrefix   = "ENC[AES256_GCM,"
+    encryptedSuffix   = "]"
+)
+
+// New random key, base64 encoded
+func GenerateEncryptionKey() string {
+    key := make([]byte, EncryptionKeySize)
+    if _, err := rand.Read(key); err != nil {
+        panic(err)
+    }
+    return base64.StdEncoding.EncodeToString(key)
+}
+
+// Key from its base64 representation, as kept in key files and env vars
+func ParseEncryptionKey(s string) ([]byte, error) {
+    key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+    if err != nil {
+        return nil, fmt.Errorf("Invalid encryption key: %s", err)
+    }
+    if len(key) != EncryptionKeySize {
+        return nil, fmt.Errorf("Invalid encryption key: %d bytes, need %d", len(key), EncryptionKeySize)
+    }
+    return key, nil
+}
+
+func IsEncrypted(s string) bool {
+    return strings.HasPrefix(s, encryptedPrefix) && strings.HasSuffix(s, encryptedSuffix)
+}
+
+func gcm(key []byte) cipher.AEAD {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        panic(err)
+    }
+    aead, err := cipher.NewGCM(block)
+    if err != nil {
+        panic(err)
+    }
+    return aead
+}
+
+// Encrypts plaintext of var name into an ENC[...] envelope
+func Encrypt(key []byte, name string, plaintext string) string {
+    aead := gcm(key)
+    nonce := make([]byte, aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        panic(err)
+    }
+    sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(name))
+    return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + encryptedSuffix
+}
+
+// Decrypts an ENC[...] envelope of var name
+func Decrypt(key []byte, name string, envelope string) (string, error) {
+    if !IsEncrypted(envelope) {
+        return "", errors.New("Not an encrypted value")
+    }
+    sealed, err := base64.StdEncoding.DecodeString(
+        strings.TrimSuffix(strings.TrimPrefix(envelope, encryptedPrefix), encryptedSuffix),
+    )
+    if err != nil {
+        return "", fmt.Errorf("Invalid encrypted value: %s", err)
+    }
+
+    aead := gcm(key)
+    if len(sealed) < aead.NonceSize() {
+        return "", errors.New("Invalid encrypted value: too short")
+    }
+    nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+    plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(name))
+    if err != nil {
+        return "", errors.New("Cannot decrypt value: wrong key, wrong var name or corrupted value")
+    }
+    return string(plaintext), nil
+}
@@ -0,0 +1,60 @@
+// Utility functions. Dotenv (KEY=VALUE lines) related.
+
+package util
+
+import (
+    "bufio"
+    "bytes"
+    "strconv"
+    "strings"
+)
+
+// Parses KEY=VALUE lines. Empty lines and # comments are skipped, "export "
+// prefix is allowed. Double quoted values are unescaped, single quoted
+// are taken literally, unquoted are trimmed and can have trailing # comments.
+func ParseDotEnv(data []byte) map[string]string {
+    env := make(map[string]string)
+
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+    line_no := 0
+    for scanner.Scan() {
+        line_no++
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        line = strings.TrimPrefix(line, "export ")
+
+        pair := strings.SplitN(line, "=", 2)
+        if len(pair) != 2 {
+            panic("dotenv line " + strconv.Itoa(line_no) + ": no =")
+        }
+        name := strings.TrimSpace(pair[0])
+        val := strings.TrimSpace(pair[1])
+
+        switch {
+            case len(val) >= 2 && val[0] == '"' && val[len(val) - 1] == '"':
+                unquoted, err := strconv.Unquote(val)
+                if err != nil {
+                    panic("dotenv line " + strconv.Itoa(line_no) + ": " + err.Error())
+                }
+                val = unquoted
+            case len(val) >= 2 && val[0] == '\'' && val[len(val) - 1] == '\'':
+                val = val[1:len(val) - 1]
+            default:
+                if i := strings.Index(val, " #"); i >= 0 {
+                    val = strings.TrimSpace(val[:i])
+                }
+        }
+
+        env[name] = val
+    }
+    if err := scanner.Err(); err != nil {
+        panic(err)
+    }
+    return env
+}
+
+func ReadDotEnv(path string) map[string]string {
+    return ParseDotEnv(SlurpFile(path))
+}
@@ -0,0 +1,64 @@
+// Utility functions. Running commands.
+
+package util
+
+import (
+    "bytes"
+    "context"
+    "os"
+    "os/exec"
+    "strings"
+    "syscall"
+    "time"
+)
+
+// Runs a command with a timeout, env is added to the inherited environment.
+// Returns stdout and stderr.
+// Command runs in its own process group, the whole group is killed on
+// timeout, so orphaned children do not hold stdout.
+func RunCommand(args []string, env []string, timeout time.Duration) ([]byte, []byte, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+
+    cmd := exec.Command(args[0], args[1:]...)
+    cmd.Env = append(os.Environ(), env...)
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout = &stdout
+    cmd.Stderr = &stderr
+    cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+    if err := cmd.Start(); err != nil {
+        return nil, nil, err
+    }
+
+    done := make(chan struct{})
+    defer close(done)
+    go func() {
+        select {
+            case <-ctx.Done():
+                syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+            case <-done:
+        }
+    }()
+
+    err := cmd.Wait()
+    if ctx.Err() != nil {
+        err = ctx.Err()
+    }
+    return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// Adds entries to env, replacing the ones with the same name
+func MergeEnv(env []string, entries []string) []string {
+    names := make(map[string]bool)
+    for _, e := range entries {
+        names[strings.SplitN(e, "=", 2)[0]] = true
+    }
+    var merged []string
+    for _, e := range env {
+        if !names[strings.SplitN(e, "=", 2)[0]] {
+            merged = append(merged, e)
+        }
+    }
+    return append(merged, entries...)
+}
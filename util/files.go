@@ -0,0 +1,88 @@
+// Utility functions. To be available in templates. Reading files,
+// restricted to a set of base directories.
+
+package util
+
+import (
+    "encoding/json"
+    "path/filepath"
+    "strings"
+)
+
+// Base dirs that file functions are allowed to read from
+type ReadableDirs []string
+
+func realPath(path string) string {
+    abs, err := filepath.Abs(path)
+    if err != nil {
+        panic(err)
+    }
+    if real, err := filepath.EvalSymlinks(abs); err == nil {
+        return real
+    }
+    return abs
+}
+
+// Whether the path (with symlinks resolved) is within one of the dirs.
+func (rd ReadableDirs) Allowed(path string) bool {
+    real := realPath(path)
+    for _, d := range rd {
+        d_real := realPath(d)
+        if real == d_real || strings.HasPrefix(real, d_real + string(filepath.Separator)) {
+            return true
+        }
+    }
+    return false
+}
+func (rd ReadableDirs) check(path string) {
+    if !rd.Allowed(path) {
+        panic(path + " is not within readable dirs")
+    }
+}
+
+func (rd ReadableDirs) ReadFile(path string) string {
+    rd.check(path)
+    return string(SlurpFile(path))
+}
+func (rd ReadableDirs) ReadLines(path string) []string {
+    rd.check(path)
+    return SlurpFileAsLines(path)
+}
+func (rd ReadableDirs) ReadJson(path string) interface{} {
+    rd.check(path)
+    var v interface{}
+    if err := json.Unmarshal(SlurpFile(path), &v); err != nil {
+        panic(err)
+    }
+    return v
+}
+func (rd ReadableDirs) ReadYaml(path string) interface{} {
+    rd.check(path)
+    var v interface{}
+    ReadYaml(path, &v)
+    return v
+}
+// Sorted matching paths. Paths outside readable dirs are skipped.
+func (rd ReadableDirs) Glob(pattern string) []string {
+    matches, err := filepath.Glob(pattern)
+    if err != nil {
+        panic(err)
+    }
+    var allowed []string
+    for _, m := range matches {
+        if rd.Allowed(m) {
+            allowed = append(allowed, m)
+        }
+    }
+    return allowed
+}
+
+func (rd ReadableDirs) FuncMap() map[string]interface{} {
+    return map[string]interface{}{
+        "readfile"  : rd.ReadFile,
+        "readlines" : rd.ReadLines,
+        "readjson"  : rd.ReadJson,
+        "readyaml"  : rd.ReadYaml,
+        "glob"      : rd.Glob,
+    }
+}
@@ -0,0 +1,140 @@
+// Utility functions. To be available in templates. Host introspection.
+
+package util
+
+import (
+    "bufio"
+    "net"
+    "os"
+    "runtime"
+    "strings"
+)
+
+const ProcMeminfo = "/proc/meminfo"
+
+func Hostname() string {
+    h, err := os.Hostname()
+    if err != nil {
+        panic(err)
+    }
+    return h
+}
+
+// Fully qualified hostname, through the resolver. Falls back to hostname.
+func Fqdn() string {
+    h := Hostname()
+    if addrs, err := net.LookupHost(h); err == nil {
+        for _, a := range addrs {
+            if names, err := net.LookupAddr(a); err == nil && len(names) > 0 {
+                return strings.TrimSuffix(names[0], ".")
+            }
+        }
+    }
+    if cname, err := net.LookupCNAME(h); err == nil && cname != "" {
+        return strings.TrimSuffix(cname, ".")
+    }
+    return h
+}
+
+// Names of network interfaces
+func Interfaces() []string {
+    ifaces, err := net.Interfaces()
+    if err != nil {
+        panic(err)
+    }
+    names := make([]string, len(ifaces))
+    for i, iface := range ifaces {
+        names[i] = iface.Name
+    }
+    return names
+}
+
+// Addresses of the interface. If interface name is empty, addresses of
+// all interfaces that are up, except loopback.
+func interfaceIPs(iface string, v4 bool) []string {
+    var ifaces []net.Interface
+    if iface == "" {
+        all, err := net.Interfaces()
+        if err != nil {
+            panic(err)
+        }
+        for _, i := range all {
+            if i.Flags & net.FlagUp != 0 && i.Flags & net.FlagLoopback == 0 {
+                ifaces = append(ifaces, i)
+            }
+        }
+    } else {
+        i, err := net.InterfaceByName(iface)
+        if err != nil {
+            panic(err)
+        }
+        ifaces = []net.Interface{*i}
+    }
+
+    var ips []string
+    for _, i := range ifaces {
+        addrs, err := i.Addrs()
+        if err != nil {
+            panic(err)
+        }
+        for _, a := range addrs {
+            ip_net, ok := a.(*net.IPNet)
+            if !ok {
+                continue
+            }
+            if is_v4 := ip_net.IP.To4() != nil; is_v4 == v4 {
+                ips = append(ips, ip_net.IP.String())
+            }
+        }
+    }
+    return ips
+}
+func IPv4s(iface string) []string { return interfaceIPs(iface, true) }
+func IPv6s(iface string) []string { return interfaceIPs(iface, false) }
+// First address, or "" if none
+func IPv4(iface string) string {
+    if ips := IPv4s(iface); len(ips) > 0 {
+        return ips[0]
+    }
+    return ""
+}
+func IPv6(iface string) string {
+    if ips := IPv6s(iface); len(ips) > 0 {
+        return ips[0]
+    }
+    return ""
+}
+
+func NumCPU() int {
+    return runtime.NumCPU()
+}
+
+// Total memory in bytes, from /proc/meminfo
+func MemTotal() int64 {
+    in_f, err := os.Open(ProcMeminfo)
+    if err != nil {
+        panic(err)
+    }
+    defer in_f.Close()
+
+    scanner := bufio.NewScanner(in_f)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) >= 2 && fields[0] == "MemTotal:" {
+            kb := ToInt64(fields[1])
+            if len(fields) > 2 && fields[2] != "kB" {
+                panic("Unexpected MemTotal unit " + fields[2])
+            }
+            return kb * 1024
+        }
+    }
+    panic("No MemTotal in " + ProcMeminfo)
+}
+
+func LookupHost(name string) []string {
+    addrs, err := net.LookupHost(name)
+    if err != nil {
+        panic(err)
+    }
+    return addrs
+}
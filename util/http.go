@@ -0,0 +1,133 @@
+// Utility functions. HTTP client related.
+
+package util
+
+import (
+    "bytes"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "time"
+)
+
+// HTTP client options, as found in source configs
+type HTTPClientConfig struct {
+    Timeout  time.Duration
+    CAFile   string
+    CertFile string
+    KeyFile  string
+    Insecure bool
+}
+// Sets options present in the map
+func (c *HTTPClientConfig) Merge(m AnyMap) {
+    if v, exists := m["timeout"]; exists {
+        c.Timeout = ToDuration(v)
+    }
+    files := map[string]*string{
+        "ca_file":   &c.CAFile,
+        "cert_file": &c.CertFile,
+        "key_file":  &c.KeyFile,
+    }
+    for k, f := range files {
+        if v, exists := m[k]; exists {
+            *f = ToString(v)
+        }
+    }
+    if v, exists := m["insecure"]; exists {
+        c.Insecure = v.(bool)
+    }
+}
+
+const DefaultHTTPTimeout = 10 * time.Second
+
+func (c *HTTPClientConfig) Client() *http.Client {
+    timeout := c.Timeout
+    if timeout == 0 {
+        timeout = DefaultHTTPTimeout
+    }
+
+    tls_config := &tls.Config{InsecureSkipVerify: c.Insecure}
+    if c.CAFile != "" {
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(SlurpFile(c.CAFile)) {
+            panic("No certificates in " + c.CAFile)
+        }
+        tls_config.RootCAs = pool
+    }
+    if c.CertFile != "" {
+        cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+        if err != nil {
+            panic(err)
+        }
+        tls_config.Certificates = []tls.Certificate{cert}
+    }
+
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.TLSClientConfig = tls_config
+    return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// Error for non 2xx responses
+type HTTPStatusError struct {
+    URL        string
+    StatusCode int
+    Body       string
+}
+func (e *HTTPStatusError) Error() string {
+    return fmt.Sprintf("%s: HTTP status %d %s", e.URL, e.StatusCode, e.Body)
+}
+
+// Makes a request, returns the response body. Non 2xx responses give HTTPStatusError.
+func HTTPRequest(client *http.Client, method string, url string, headers map[string]string, body []byte) ([]byte, error) {
+    req, err := http.NewRequest(method, url, bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    for n, v := range headers {
+        req.Header.Set(n, v)
+    }
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    resp_body, err := ioutil.ReadAll(resp.Body)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        if len(resp_body) > 512 {
+            resp_body = resp_body[:512]
+        }
+        return nil, &HTTPStatusError{url, resp.StatusCode, string(bytes.TrimSpace(resp_body))}
+    }
+    return resp_body, nil
+}
+
+// HTTPRequest with JSON request and response. Response is decoded into target.
+func HTTPRequestJSON(client *http.Client, method string, url string, headers map[string]string, request interface{}, target interface{}) error {
+    var body []byte
+    if request != nil {
+        var err error
+        if body, err = json.Marshal(request); err != nil {
+            return err
+        }
+        if headers == nil {
+            headers = make(map[string]string)
+        }
+        headers["Content-Type"] = "application/json"
+    }
+
+    resp_body, err := HTTPRequest(client, method, url, headers, body)
+    if err != nil {
+        return err
+    }
+    dec := json.NewDecoder(bytes.NewReader(resp_body))
+    dec.UseNumber()
+    return dec.Decode(target)
+}
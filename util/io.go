@@ -8,7 +8,11 @@ import (
     "fmt"
     "io/ioutil"
     "bufio"
+    "math/rand"
     "path/filepath"
+    "strconv"
+    "strings"
+    "syscall"
 )
 
 func SlurpFile(path string) []byte {
@@ -127,3 +131,50 @@ func ResolveLink(path string) string {
     }
     return path
 }
+
+// Writes content into a new temp file next to path, keeping the extension.
+// The file is created with mode (before umask). Returns the temp file path.
+func WriteTempFile(path string, content []byte, mode os.FileMode) string {
+    dir, fname := filepath.Split(path)
+    ext := filepath.Ext(fname)
+    prefix := filepath.Join(dir, "." + strings.TrimSuffix(fname, ext) + ".")
+    for {
+        tmp_path := prefix + strconv.Itoa(int(rand.Int31())) + ext
+        tmp_f, err := os.OpenFile(tmp_path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+        if os.IsExist(err) {
+            continue
+        }
+        if err != nil {
+            panic(err)
+        }
+
+        _, err = tmp_f.Write(content)
+        if c_err := tmp_f.Close(); err == nil {
+            err = c_err
+        }
+        if err != nil {
+            os.Remove(tmp_path)
+            panic(err)
+        }
+        return tmp_path
+    }
+}
+
+// Writes into a temp file in the same dir, then renames it into place
+func WriteFileAtomic(path string, content []byte, mode os.FileMode) {
+    tmp_path := WriteTempFile(path, content, mode)
+    defer os.Remove(tmp_path)
+
+    if err := os.Chmod(tmp_path, mode); err != nil {
+        panic(err)
+    }
+    if err := os.Rename(tmp_path, path); err != nil {
+        panic(err)
+    }
+}
+
+// File owner uid and gid
+func FileOwner(info os.FileInfo) (int, int) {
+    stat := info.Sys().(*syscall.Stat_t)
+    return int(stat.Uid), int(stat.Gid)
+}
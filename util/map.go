@@ -1,3 +1,66 @@
 package util
 
+import (
+    "strings"
+)
+
 type AnyMap = map[string]interface{}
+
+// Turns flat "a.b.c" keyed map into a nested map.
+// If a key is both a value and a parent ("a" and "a.b"), the parent wins.
+func Unflatten(m map[string]string, separator string) AnyMap {
+    return UnflattenFunc(m, func(k string) []string {
+        return strings.Split(k, separator)
+    })
+}
+
+// As Unflatten, with keys turned into paths by split.
+func UnflattenFunc(m map[string]string, split func(string) []string) AnyMap {
+    tree := make(AnyMap)
+    for k, v := range m {
+        node := tree
+        path := split(k)
+        for _, p := range path[:len(path) - 1] {
+            child, ok := node[p].(AnyMap)
+            if !ok {
+                child = make(AnyMap)
+                node[p] = child
+            }
+            node = child
+        }
+        leaf := path[len(path) - 1]
+        if _, is_parent := node[leaf].(AnyMap); !is_parent {
+            node[leaf] = v
+        }
+    }
+    return tree
+}
+
+// Turns nested maps into a flat map with "a.b.c" keys.
+// List elements get their index as the key.
+func Flatten(m AnyMap, separator string) AnyMap {
+    flat := make(AnyMap)
+    var walk func(name string, v interface{})
+    walk = func(name string, v interface{}) {
+        switch v_t := v.(type) {
+            case AnyMap:
+                for k, e := range v_t {
+                    walk(name + separator + k, e)
+                }
+            case map[interface{}]interface{}:
+                for k, e := range v_t {
+                    walk(name + separator + ToString(k), e)
+                }
+            case []interface{}:
+                for i, e := range v_t {
+                    walk(name + separator + ToString(i), e)
+                }
+            default:
+                flat[name] = v
+        }
+    }
+    for k, v := range m {
+        walk(k, v)
+    }
+    return flat
+}
@@ -0,0 +1,40 @@
+// Utility functions. JSONPath-like selection from decoded JSON/YAML data.
+
+package util
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// Selects part of data by path like "$.data.items[0].vars" or "data.items.0".
+// Empty path or "$" selects data itself.
+func SelectPath(data interface{}, path string) (interface{}, error) {
+    path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+    if path == "" {
+        return data, nil
+    }
+    path = strings.ReplaceAll(strings.ReplaceAll(path, "[", "."), "]", "")
+
+    node := data
+    for _, p := range strings.Split(path, ".") {
+        switch n := node.(type) {
+            case AnyMap:
+                child, exists := n[p]
+                if !exists {
+                    return nil, fmt.Errorf("%s: no key %s", path, p)
+                }
+                node = child
+            case []interface{}:
+                i, err := strconv.Atoi(p)
+                if err != nil || i < 0 || i >= len(n) {
+                    return nil, fmt.Errorf("%s: invalid index %s", path, p)
+                }
+                node = n[i]
+            default:
+                return nil, fmt.Errorf("%s: cannot select %s from %v", path, p, node)
+        }
+    }
+    return node, nil
+}
@@ -74,3 +74,18 @@ func TimeOffset(seed string) int {
     }
     return int(crc32.ChecksumIEEE( []byte(seed) ) % 60)
 }
+
+// Sprig compatible default: given if it is not empty, d otherwise
+func Default(d interface{}, given ...interface{}) interface{} {
+    if len(given) == 0 || IsEmpty(given[0]) {
+        return d
+    }
+    return given[0]
+}
+
+func Ternary(t, f interface{}, cond bool) interface{} {
+    if cond {
+        return t
+    }
+    return f
+}
@@ -0,0 +1,218 @@
+// Utility functions. To be available in templates. Lists and dicts.
+
+package util
+
+import (
+    "reflect"
+    "sort"
+)
+
+func List(items ...interface{}) []interface{} {
+    return items
+}
+
+func First(l interface{}) interface{} {
+    s := ToSlice(l)
+    if len(s) == 0 {
+        return nil
+    }
+    return s[0]
+}
+func Last(l interface{}) interface{} {
+    s := ToSlice(l)
+    if len(s) == 0 {
+        return nil
+    }
+    return s[len(s) - 1]
+}
+// All but the first
+func Rest(l interface{}) []interface{} {
+    s := ToSlice(l)
+    if len(s) == 0 {
+        return nil
+    }
+    return s[1:]
+}
+// All but the last
+func Initial(l interface{}) []interface{} {
+    s := ToSlice(l)
+    if len(s) == 0 {
+        return nil
+    }
+    return s[:len(s) - 1]
+}
+
+func Append(l interface{}, v interface{}) []interface{} {
+    return append(ToSlice(l), v)
+}
+func Prepend(l interface{}, v interface{}) []interface{} {
+    return append([]interface{}{v}, ToSlice(l)...)
+}
+func Concat(lists ...interface{}) []interface{} {
+    var r []interface{}
+    for _, l := range lists {
+        r = append(r, ToSlice(l)...)
+    }
+    return r
+}
+func Reverse(l interface{}) []interface{} {
+    s := ToSlice(l)
+    r := make([]interface{}, len(s))
+    for i, v := range s {
+        r[len(s) - 1 - i] = v
+    }
+    return r
+}
+
+func Uniq(l interface{}) []interface{} {
+    var r []interface{}
+    for _, v := range ToSlice(l) {
+        if !Has(v, r) {
+            r = append(r, v)
+        }
+    }
+    return r
+}
+// Removes empty elements
+func Compact(l interface{}) []interface{} {
+    var r []interface{}
+    for _, v := range ToSlice(l) {
+        if !IsEmpty(v) {
+            r = append(r, v)
+        }
+    }
+    return r
+}
+func Without(l interface{}, omit ...interface{}) []interface{} {
+    var r []interface{}
+    for _, v := range ToSlice(l) {
+        if !Has(v, omit) {
+            r = append(r, v)
+        }
+    }
+    return r
+}
+
+// Whether the list contains the needle
+func Has(needle interface{}, l interface{}) bool {
+    for _, v := range ToSlice(l) {
+        if reflect.DeepEqual(v, needle) {
+            return true
+        }
+    }
+    return false
+}
+
+func SortAlpha(l interface{}) []string {
+    s := ToStrings(l)
+    sort.Strings(s)
+    return s
+}
+
+// Makes a dict from key value pairs. Odd number of args gives the last key an empty value.
+func Dict(kv ...interface{}) map[string]interface{} {
+    d := make(map[string]interface{}, len(kv) / 2)
+    for i := 0; i < len(kv); i += 2 {
+        k := ToString(kv[i])
+        if i + 1 < len(kv) {
+            d[k] = kv[i + 1]
+        } else {
+            d[k] = ""
+        }
+    }
+    return d
+}
+
+// Turns map-ish into a dict. Anything else gives nil.
+func ToDict(m interface{}) map[string]interface{} {
+    if m == nil {
+        return nil
+    }
+    if d, ok := m.(map[string]interface{}); ok {
+        return d
+    }
+
+    v := reflect.ValueOf(m)
+    if v.Kind() != reflect.Map {
+        return nil
+    }
+    d := make(map[string]interface{}, v.Len())
+    iter := v.MapRange()
+    for iter.Next() {
+        d[ToString(iter.Key().Interface())] = iter.Value().Interface()
+    }
+    return d
+}
+
+func Get(m interface{}, k string) interface{} {
+    return ToDict(m)[k]
+}
+func Set(d map[string]interface{}, k string, v interface{}) map[string]interface{} {
+    d[k] = v
+    return d
+}
+func Unset(d map[string]interface{}, k string) map[string]interface{} {
+    delete(d, k)
+    return d
+}
+func HasKey(m interface{}, k string) bool {
+    _, exists := ToDict(m)[k]
+    return exists
+}
+
+// Sorted keys of dicts
+func Keys(ms ...interface{}) []string {
+    seen := make(map[string]bool)
+    var keys []string
+    for _, m := range ms {
+        for k, _ := range ToDict(m) {
+            if !seen[k] {
+                seen[k] = true
+                keys = append(keys, k)
+            }
+        }
+    }
+    sort.Strings(keys)
+    return keys
+}
+// Values, sorted by key
+func Values(m interface{}) []interface{} {
+    d := ToDict(m)
+    var vs []interface{}
+    for _, k := range Keys(d) {
+        vs = append(vs, d[k])
+    }
+    return vs
+}
+func Pick(m interface{}, keys ...string) map[string]interface{} {
+    d := ToDict(m)
+    r := make(map[string]interface{})
+    for _, k := range keys {
+        if v, exists := d[k]; exists {
+            r[k] = v
+        }
+    }
+    return r
+}
+func Omit(m interface{}, keys ...string) map[string]interface{} {
+    r := make(map[string]interface{})
+    for k, v := range ToDict(m) {
+        r[k] = v
+    }
+    for _, k := range keys {
+        delete(r, k)
+    }
+    return r
+}
+// Merges dicts into a new one, first one wins
+func Merge(ms ...interface{}) map[string]interface{} {
+    r := make(map[string]interface{})
+    for _, m := range ms {
+        for k, v := range ToDict(m) {
+            if _, exists := r[k]; !exists {
+                r[k] = v
+            }
+        }
+    }
+    return r
+}
@@ -0,0 +1,54 @@
+// Utility functions. To be available in templates. Dates.
+// Formats are Go time layouts, ie "2006-01-02 15:04:05".
+
+package util
+
+import (
+    "time"
+)
+
+// Turns time.Time, unix timestamp (number or string) into time.Time.
+// nil gives current time.
+func ToTime(t interface{}) time.Time {
+    switch v := t.(type) {
+        case nil:
+            return time.Now()
+        case time.Time:
+            return v
+        case *time.Time:
+            return *v
+    }
+    return time.Unix(ToInt64(t), 0)
+}
+
+func Now() time.Time {
+    return time.Now()
+}
+
+func Date(layout string, t interface{}) string {
+    return ToTime(t).Local().Format(layout)
+}
+func DateInZone(layout string, t interface{}, zone string) string {
+    loc, err := time.LoadLocation(zone)
+    if err != nil {
+        panic(err)
+    }
+    return ToTime(t).In(loc).Format(layout)
+}
+func UnixEpoch(t interface{}) string {
+    return ToString(ToTime(t).Unix())
+}
+func ToDate(layout string, s interface{}) time.Time {
+    t, err := time.ParseInLocation(layout, ToString(s), time.Local)
+    if err != nil {
+        panic(err)
+    }
+    return t
+}
+func DateModify(duration string, t interface{}) time.Time {
+    d, err := time.ParseDuration(duration)
+    if err != nil {
+        panic(err)
+    }
+    return ToTime(t).Add(d)
+}
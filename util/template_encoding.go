@@ -0,0 +1,87 @@
+// Utility functions. To be available in templates. Encodings and hashes.
+
+package util
+
+import (
+    "bytes"
+    "crypto/sha1"
+    "crypto/sha256"
+    "crypto/sha512"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "hash/adler32"
+    "strconv"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+func B64Enc(s interface{}) string {
+    return base64.StdEncoding.EncodeToString([]byte(ToString(s)))
+}
+func B64Dec(s interface{}) string {
+    data, err := base64.StdEncoding.DecodeString(ToString(s))
+    if err != nil {
+        panic(err)
+    }
+    return string(data)
+}
+
+func Sha1Sum(s interface{}) string {
+    sum := sha1.Sum([]byte(ToString(s)))
+    return hex.EncodeToString(sum[:])
+}
+func Sha256Sum(s interface{}) string {
+    sum := sha256.Sum256([]byte(ToString(s)))
+    return hex.EncodeToString(sum[:])
+}
+func Sha512Sum(s interface{}) string {
+    sum := sha512.Sum512([]byte(ToString(s)))
+    return hex.EncodeToString(sum[:])
+}
+func Adler32Sum(s interface{}) string {
+    return strconv.FormatUint(uint64(adler32.Checksum([]byte(ToString(s)))), 10)
+}
+
+func ToJson(v interface{}) string {
+    var buff bytes.Buffer
+    enc := json.NewEncoder(&buff)
+    enc.SetEscapeHTML(false)
+    if err := enc.Encode(v); err != nil {
+        panic(err)
+    }
+    return strings.TrimSuffix(buff.String(), "\n")
+}
+func ToPrettyJson(v interface{}) string {
+    var buff bytes.Buffer
+    enc := json.NewEncoder(&buff)
+    enc.SetEscapeHTML(false)
+    enc.SetIndent("", "  ")
+    if err := enc.Encode(v); err != nil {
+        panic(err)
+    }
+    return strings.TrimSuffix(buff.String(), "\n")
+}
+func FromJson(s interface{}) interface{} {
+    var v interface{}
+    if err := json.Unmarshal([]byte(ToString(s)), &v); err != nil {
+        panic(err)
+    }
+    return v
+}
+
+func ToYaml(v interface{}) string {
+    data, err := yaml.Marshal(v)
+    if err != nil {
+        panic(err)
+    }
+    return strings.TrimSuffix(string(data), "\n")
+}
+func FromYaml(s interface{}) interface{} {
+    var v interface{}
+    if err := yaml.Unmarshal([]byte(ToString(s)), &v); err != nil {
+        panic(err)
+    }
+    return v
+}
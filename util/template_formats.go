@@ -0,0 +1,226 @@
+// Utility functions. To be available in templates. Structured data output.
+// Dicts are serialised with sorted keys, so the output is stable.
+
+package util
+
+import (
+    "fmt"
+    "reflect"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Turns string values that look like booleans or integers into those,
+// recursively. Anything else is left as is.
+func Typed(v interface{}) interface{} {
+    switch v_t := v.(type) {
+        case string:
+            switch v_t {
+                case "true":
+                    return true
+                case "false":
+                    return false
+            }
+            if n, err := strconv.ParseInt(v_t, 10, 64); err == nil && strconv.FormatInt(n, 10) == v_t {
+                return n
+            }
+            return v_t
+        case []interface{}:
+            l := make([]interface{}, len(v_t))
+            for i, e := range v_t {
+                l[i] = Typed(e)
+            }
+            return l
+    }
+
+    if d := ToDict(v); d != nil {
+        typed := make(AnyMap, len(d))
+        for k, e := range d {
+            typed[k] = Typed(e)
+        }
+        return typed
+    }
+    return v
+}
+
+func sortedKeys(d AnyMap) []string {
+    keys := make([]string, 0, len(d))
+    for k, _ := range d {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+var toml_bare_key = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(k string) string {
+    if toml_bare_key.MatchString(k) {
+        return k
+    }
+    return tomlString(k)
+}
+func tomlString(s string) string {
+    var b strings.Builder
+    b.WriteByte('"')
+    for _, r := range s {
+        switch r {
+            case '"':  b.WriteString(`\"`)
+            case '\\': b.WriteString(`\\`)
+            case '\n': b.WriteString(`\n`)
+            case '\r': b.WriteString(`\r`)
+            case '\t': b.WriteString(`\t`)
+            case '\b': b.WriteString(`\b`)
+            case '\f': b.WriteString(`\f`)
+            default:
+                if r < 0x20 || r == 0x7f {
+                    fmt.Fprintf(&b, `\u%04X`, r)
+                } else {
+                    b.WriteRune(r)
+                }
+        }
+    }
+    b.WriteByte('"')
+    return b.String()
+}
+func tomlValue(v interface{}) string {
+    switch v_t := v.(type) {
+        case nil:
+            return `""`
+        case string:
+            return tomlString(v_t)
+        case bool:
+            return strconv.FormatBool(v_t)
+        case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+            return ToString(v_t)
+        case float32, float64:
+            return strconv.FormatFloat(ToFloat64(v_t), 'g', -1, 64)
+    }
+
+    if d := ToDict(v); d != nil {
+        pairs := make([]string, 0, len(d))
+        for _, k := range sortedKeys(d) {
+            pairs = append(pairs, tomlKey(k) + " = " + tomlValue(d[k]))
+        }
+        return "{" + strings.Join(pairs, ", ") + "}"
+    }
+
+    if k := reflect.ValueOf(v).Kind(); k != reflect.Slice && k != reflect.Array {
+        return tomlString(ToString(v))
+    }
+
+    l := ToSlice(v)
+    vals := make([]string, len(l))
+    for i, e := range l {
+        vals[i] = tomlValue(e)
+    }
+    return "[" + strings.Join(vals, ", ") + "]"
+}
+func writeTomlTable(b *strings.Builder, path []string, d AnyMap) {
+    var tables []string
+    for _, k := range sortedKeys(d) {
+        if _, is_table := d[k].(AnyMap); is_table {
+            tables = append(tables, k)
+            continue
+        }
+        fmt.Fprintf(b, "%s = %s\n", tomlKey(k), tomlValue(d[k]))
+    }
+
+    for _, k := range tables {
+        t_path := append(append([]string{}, path...), tomlKey(k))
+        if b.Len() > 0 {
+            b.WriteByte('\n')
+        }
+        fmt.Fprintf(b, "[%s]\n", strings.Join(t_path, "."))
+        writeTomlTable(b, t_path, d[k].(AnyMap))
+    }
+}
+
+// Dict to TOML document
+func ToToml(v interface{}) string {
+    var b strings.Builder
+    writeTomlTable(&b, nil, toAnyMapTree(v))
+    return b.String()
+}
+
+// Converts all dict-like values to AnyMap, recursively
+func toAnyMapTree(v interface{}) AnyMap {
+    d := ToDict(v)
+    if d == nil {
+        panic(fmt.Sprintf("%T is not a dict", v))
+    }
+
+    tree := make(AnyMap, len(d))
+    for k, e := range d {
+        if ToDict(e) != nil {
+            tree[k] = toAnyMapTree(e)
+        } else {
+            tree[k] = e
+        }
+    }
+    return tree
+}
+
+func iniValue(v interface{}) string {
+    s := ToString(v)
+    if s != strings.TrimSpace(s) || strings.ContainsAny(s, "\";#=\n") {
+        return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+    }
+    return s
+}
+func writeIniSection(b *strings.Builder, name string, d AnyMap) {
+    var sections []string
+    for _, k := range sortedKeys(d) {
+        if _, is_section := d[k].(AnyMap); is_section {
+            sections = append(sections, k)
+            continue
+        }
+        fmt.Fprintf(b, "%s = %s\n", k, iniValue(d[k]))
+    }
+
+    for _, k := range sections {
+        s_name := k
+        if name != "" {
+            s_name = name + "." + k
+        }
+        if b.Len() > 0 {
+            b.WriteByte('\n')
+        }
+        fmt.Fprintf(b, "[%s]\n", s_name)
+        writeIniSection(b, s_name, d[k].(AnyMap))
+    }
+}
+
+// Dict to INI. Top level values come first, dicts become [sections],
+// nested dicts become [section.subsection].
+func ToIni(v interface{}) string {
+    var b strings.Builder
+    writeIniSection(&b, "", toAnyMapTree(v))
+    return b.String()
+}
+
+var shell_name_invalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func ShellQuote(v interface{}) string {
+    return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`").Replace(ToString(v)) + `"`
+}
+func writeShell(b *strings.Builder, prefix string, d AnyMap) {
+    for _, k := range sortedKeys(d) {
+        name := shell_name_invalid.ReplaceAllString(prefix + k, "_")
+        if sub, is_dict := d[k].(AnyMap); is_dict {
+            writeShell(b, name + "_", sub)
+            continue
+        }
+        fmt.Fprintf(b, "%s=%s\n", name, ShellQuote(d[k]))
+    }
+}
+
+// Dict to shell/dotenv KEY="value" lines. Nested dict keys are joined with _,
+// characters not valid in shell var names are replaced with _.
+func ToShell(v interface{}) string {
+    var b strings.Builder
+    writeShell(&b, "", toAnyMapTree(v))
+    return b.String()
+}
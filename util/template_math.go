@@ -0,0 +1,53 @@
+// Utility functions. To be available in templates. Lenient math.
+// Arguments can be anything number-like, including strings.
+
+package util
+
+import (
+    "math"
+)
+
+func Add(a interface{}, b ...interface{}) int64 {
+    r := ToInt64(a)
+    for _, b1 := range b {
+        r += ToInt64(b1)
+    }
+    return r
+}
+func Add1(a interface{}) int64   { return ToInt64(a) + 1 }
+func Sub(a, b interface{}) int64 { return ToInt64(a) - ToInt64(b) }
+func Mul(a interface{}, b ...interface{}) int64 {
+    r := ToInt64(a)
+    for _, b1 := range b {
+        r *= ToInt64(b1)
+    }
+    return r
+}
+func Div(a, b interface{}) int64 { return ToInt64(a) / ToInt64(b) }
+func Mod(a, b interface{}) int64 { return ToInt64(a) % ToInt64(b) }
+
+func Max(a interface{}, b ...interface{}) int64 {
+    r := ToInt64(a)
+    for _, b1 := range b {
+        if n := ToInt64(b1); n > r {
+            r = n
+        }
+    }
+    return r
+}
+func Min(a interface{}, b ...interface{}) int64 {
+    r := ToInt64(a)
+    for _, b1 := range b {
+        if n := ToInt64(b1); n < r {
+            r = n
+        }
+    }
+    return r
+}
+
+func Floor(a interface{}) float64 { return math.Floor(ToFloat64(a)) }
+func Ceil(a interface{}) float64  { return math.Ceil(ToFloat64(a)) }
+func Round(a interface{}, precision int) float64 {
+    p := math.Pow10(precision)
+    return math.Round(ToFloat64(a) * p) / p
+}
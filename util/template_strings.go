@@ -0,0 +1,146 @@
+// Utility functions. To be available in templates. String manipulation.
+// Argument order follows Sprig, so the subject string comes last and
+// functions can be used in pipelines, ie {{ .var | trimPrefix "x" | upper }}
+
+package util
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+    "unicode"
+)
+
+func Upper(s interface{}) string { return strings.ToUpper(ToString(s)) }
+func Lower(s interface{}) string { return strings.ToLower(ToString(s)) }
+// Uppercases the first letter of each word, whitespace is kept as it is
+func Title(s interface{}) string {
+    var b strings.Builder
+    word_start := true
+    for _, r := range ToString(s) {
+        if word_start {
+            r = unicode.ToUpper(r)
+        }
+        word_start = unicode.IsSpace(r)
+        b.WriteRune(r)
+    }
+    return b.String()
+}
+
+func Trim(s interface{}) string                      { return strings.TrimSpace(ToString(s)) }
+func TrimAll(cutset string, s interface{}) string    { return strings.Trim(ToString(s), cutset) }
+func TrimPrefix(prefix string, s interface{}) string { return strings.TrimPrefix(ToString(s), prefix) }
+func TrimSuffix(suffix string, s interface{}) string { return strings.TrimSuffix(ToString(s), suffix) }
+func NoSpace(s interface{}) string {
+    return strings.Join(strings.Fields(ToString(s)), "")
+}
+
+func Contains(substr string, s interface{}) bool    { return strings.Contains(ToString(s), substr) }
+func HasPrefix(prefix string, s interface{}) bool   { return strings.HasPrefix(ToString(s), prefix) }
+func HasSuffix(suffix string, s interface{}) bool   { return strings.HasSuffix(ToString(s), suffix) }
+
+func Repeat(count int, s interface{}) string        { return strings.Repeat(ToString(s), count) }
+func Replace(old, new string, s interface{}) string { return strings.ReplaceAll(ToString(s), old, new) }
+
+// Substring from start to end (exclusive). Out of range indexes are clipped,
+// negative end means to the end of the string.
+func Substr(start, end int, s interface{}) string {
+    s_s := ToString(s)
+    if start < 0 {
+        start = 0
+    }
+    if end < 0 || end > len(s_s) {
+        end = len(s_s)
+    }
+    if start > end {
+        return ""
+    }
+    return s_s[start:end]
+}
+
+// Truncates to length. Negative length truncates from the beginning.
+func Trunc(length int, s interface{}) string {
+    s_s := ToString(s)
+    if length < 0 {
+        if -length < len(s_s) {
+            return s_s[len(s_s) + length:]
+        }
+        return s_s
+    }
+    if length < len(s_s) {
+        return s_s[:length]
+    }
+    return s_s
+}
+
+func Quote(s ...interface{}) string {
+    quoted := make([]string, 0, len(s))
+    for _, s1 := range s {
+        if s1 != nil {
+            quoted = append(quoted, fmt.Sprintf("%q", ToString(s1)))
+        }
+    }
+    return strings.Join(quoted, " ")
+}
+func SQuote(s ...interface{}) string {
+    quoted := make([]string, 0, len(s))
+    for _, s1 := range s {
+        if s1 != nil {
+            quoted = append(quoted, "'" + ToString(s1) + "'")
+        }
+    }
+    return strings.Join(quoted, " ")
+}
+
+// Joins non-nil args with a space
+func Cat(s ...interface{}) string {
+    strs := make([]string, 0, len(s))
+    for _, s1 := range s {
+        if s1 != nil {
+            strs = append(strs, ToString(s1))
+        }
+    }
+    return strings.Join(strs, " ")
+}
+
+// Indents every line with spaces
+func Indent(spaces int, s interface{}) string {
+    pad := strings.Repeat(" ", spaces)
+    return pad + strings.ReplaceAll(ToString(s), "\n", "\n" + pad)
+}
+// Same as Indent, with a leading newline
+func NIndent(spaces int, s interface{}) string {
+    return "\n" + Indent(spaces, s)
+}
+
+// Sprig compatible split - returns a map with keys _0, _1, ...
+func Split(separator string, s interface{}) map[string]string {
+    parts := strings.Split(ToString(s), separator)
+    m := make(map[string]string, len(parts))
+    for i, p := range parts {
+        m[fmt.Sprintf("_%d", i)] = p
+    }
+    return m
+}
+func SplitList(separator string, s interface{}) []string {
+    return strings.Split(ToString(s), separator)
+}
+func Join(separator string, list interface{}) string {
+    return strings.Join(ToStrings(list), separator)
+}
+
+func RegexMatch(re string, s interface{}) bool {
+    return regexp.MustCompile(re).MatchString(ToString(s))
+}
+func RegexFind(re string, s interface{}) string {
+    return regexp.MustCompile(re).FindString(ToString(s))
+}
+func RegexFindAll(re string, n int, s interface{}) []string {
+    return regexp.MustCompile(re).FindAllString(ToString(s), n)
+}
+func RegexReplaceAll(re string, s interface{}, replacement string) string {
+    return regexp.MustCompile(re).ReplaceAllString(ToString(s), replacement)
+}
+func RegexSplit(re string, n int, s interface{}) []string {
+    return regexp.MustCompile(re).Split(ToString(s), n)
+}
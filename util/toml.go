@@ -0,0 +1,321 @@
+// Utility functions. TOML related.
+// A small TOML reader: tables, dotted keys, strings, numbers, booleans,
+// arrays and inline tables. Dates are read as strings. Multi-line strings
+// and arrays of tables are not supported, they fail with a parse error.
+
+package util
+
+import (
+    "fmt"
+    "math"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Numbers (underscores removed) and dates. Decimals cannot have leading
+// zeros, special floats are only inf and nan.
+var (
+    toml_int           = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)$`)
+    toml_based_int     = regexp.MustCompile(`^0(x[0-9a-fA-F]+|o[0-7]+|b[01]+)$`)
+    toml_float         = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+    toml_special_float = regexp.MustCompile(`^[+-]?(inf|nan)$`)
+    toml_date_time     = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2}|[0-9]{2}:[0-9]{2})`)
+)
+
+type tomlParser struct {
+    data []byte
+    pos  int
+    line int
+}
+
+func (p *tomlParser) fail(format string, v ...interface{}) {
+    panic(fmt.Sprintf("TOML line %d: %s", p.line, fmt.Sprintf(format, v...)))
+}
+func (p *tomlParser) eof() bool { return p.pos >= len(p.data) }
+func (p *tomlParser) peek() byte {
+    if p.eof() {
+        return 0
+    }
+    return p.data[p.pos]
+}
+func (p *tomlParser) next() byte {
+    c := p.peek()
+    p.pos++
+    if c == '\n' {
+        p.line++
+    }
+    return c
+}
+func (p *tomlParser) expect(c byte) {
+    if got := p.next(); got != c {
+        p.fail("expected %q, got %q", c, got)
+    }
+}
+// Skips spaces and comments; newlines too if multiline
+func (p *tomlParser) skip(multiline bool) {
+    for !p.eof() {
+        switch c := p.peek(); {
+            case c == ' ' || c == '\t' || c == '\r':
+                p.next()
+            case c == '\n' && multiline:
+                p.next()
+            case c == '#':
+                for !p.eof() && p.peek() != '\n' {
+                    p.next()
+                }
+            default:
+                return
+        }
+    }
+}
+func (p *tomlParser) endOfLine() {
+    p.skip(false)
+    if !p.eof() && p.next() != '\n' {
+        p.fail("expected end of line")
+    }
+}
+
+func isBareKeyChar(c byte) bool {
+    return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+func (p *tomlParser) key() []string {
+    var path []string
+    for {
+        p.skip(false)
+        switch c := p.peek(); {
+            case c == '"':
+                path = append(path, p.basicString())
+            case c == '\'':
+                path = append(path, p.literalString())
+            case isBareKeyChar(c):
+                start := p.pos
+                for !p.eof() && isBareKeyChar(p.peek()) {
+                    p.next()
+                }
+                path = append(path, string(p.data[start:p.pos]))
+            default:
+                p.fail("invalid key")
+        }
+        p.skip(false)
+        if p.peek() != '.' {
+            return path
+        }
+        p.next()
+    }
+}
+
+func (p *tomlParser) basicString() string {
+    p.expect('"')
+    if strings.HasPrefix(string(p.data[p.pos:]), `""`) {
+        p.fail("multi-line strings are not supported")
+    }
+    var b strings.Builder
+    for {
+        if p.eof() {
+            p.fail("unterminated string")
+        }
+        c := p.next()
+        switch c {
+            case '"':
+                return b.String()
+            case '\n':
+                p.fail("unterminated string")
+            case '\\':
+                switch e := p.next(); e {
+                    case 'b':  b.WriteByte('\b')
+                    case 't':  b.WriteByte('\t')
+                    case 'n':  b.WriteByte('\n')
+                    case 'f':  b.WriteByte('\f')
+                    case 'r':  b.WriteByte('\r')
+                    case '"':  b.WriteByte('"')
+                    case '\\': b.WriteByte('\\')
+                    case 'u', 'U':
+                        n := 4
+                        if e == 'U' {
+                            n = 8
+                        }
+                        if p.pos + n > len(p.data) {
+                            p.fail("invalid escape")
+                        }
+                        r, err := strconv.ParseUint(string(p.data[p.pos:p.pos + n]), 16, 32)
+                        if err != nil || !utf8.ValidRune(rune(r)) {
+                            p.fail("invalid escape")
+                        }
+                        p.pos += n
+                        b.WriteRune(rune(r))
+                    default:
+                        p.fail("invalid escape \\%c", e)
+                }
+            default:
+                b.WriteByte(c)
+        }
+    }
+}
+func (p *tomlParser) literalString() string {
+    p.expect('\'')
+    if strings.HasPrefix(string(p.data[p.pos:]), "''") {
+        p.fail("multi-line strings are not supported")
+    }
+    start := p.pos
+    for {
+        if p.eof() || p.peek() == '\n' {
+            p.fail("unterminated string")
+        }
+        if p.next() == '\'' {
+            return string(p.data[start:p.pos - 1])
+        }
+    }
+}
+
+func (p *tomlParser) value() interface{} {
+    switch c := p.peek(); c {
+        case '"':
+            return p.basicString()
+        case '\'':
+            return p.literalString()
+        case '[':
+            p.next()
+            var l []interface{}
+            for {
+                p.skip(true)
+                if p.peek() == ']' {
+                    p.next()
+                    return l
+                }
+                l = append(l, p.value())
+                p.skip(true)
+                if p.peek() == ',' {
+                    p.next()
+                } else if p.peek() != ']' {
+                    p.fail("expected , or ]")
+                }
+            }
+        case '{':
+            p.next()
+            t := make(AnyMap)
+            for {
+                p.skip(false)
+                if p.peek() == '}' {
+                    p.next()
+                    return t
+                }
+                p.keyValue(t)
+                p.skip(false)
+                if p.peek() == ',' {
+                    p.next()
+                } else if p.peek() != '}' {
+                    p.fail("expected , or }")
+                }
+            }
+    }
+
+    start := p.pos
+    for !p.eof() && strings.IndexByte(" \t\r\n,]}#", p.peek()) < 0 {
+        p.next()
+    }
+    raw := string(p.data[start:p.pos])
+    switch raw {
+        case "true":
+            return true
+        case "false":
+            return false
+        case "":
+            p.fail("missing value")
+    }
+    num := strings.ReplaceAll(raw, "_", "")
+    if toml_int.MatchString(num) || toml_based_int.MatchString(num) {
+        i, err := strconv.ParseInt(num, 0, 64)
+        if err != nil {
+            p.fail("invalid integer %s", raw)
+        }
+        return i
+    }
+    if toml_special_float.MatchString(num) && strings.HasSuffix(num, "nan") {
+        // strconv does not take signed nan
+        return math.NaN()
+    }
+    if toml_float.MatchString(num) || toml_special_float.MatchString(num) {
+        f, err := strconv.ParseFloat(num, 64)
+        if err != nil {
+            p.fail("invalid float %s", raw)
+        }
+        return f
+    }
+    // Dates and times
+    if toml_date_time.MatchString(raw) {
+        // Local date-time may have a space instead of T
+        if len(raw) == 10 && p.peek() == ' ' && p.pos + 1 < len(p.data) && p.data[p.pos + 1] >= '0' && p.data[p.pos + 1] <= '9' {
+            p.next()
+            for !p.eof() && strings.IndexByte(" \t\r\n,]}#", p.peek()) < 0 {
+                p.next()
+            }
+            return string(p.data[start:p.pos])
+        }
+        return raw
+    }
+    p.fail("invalid value %s", raw)
+    return nil
+}
+
+// Descends into table by path, creating missing tables
+func (p *tomlParser) table(root AnyMap, path []string) AnyMap {
+    t := root
+    for _, k := range path {
+        switch v := t[k].(type) {
+            case nil:
+                sub := make(AnyMap)
+                t[k] = sub
+                t = sub
+            case AnyMap:
+                t = v
+            default:
+                p.fail("%s is not a table", strings.Join(path, "."))
+        }
+    }
+    return t
+}
+func (p *tomlParser) keyValue(t AnyMap) {
+    path := p.key()
+    p.expect('=')
+    p.skip(false)
+    v := p.value()
+
+    t = p.table(t, path[:len(path) - 1])
+    k := path[len(path) - 1]
+    if _, exists := t[k]; exists {
+        p.fail("duplicate key %s", strings.Join(path, "."))
+    }
+    t[k] = v
+}
+
+func ParseToml(data []byte) AnyMap {
+    p := &tomlParser{data: data, line: 1}
+    root := make(AnyMap)
+    current := root
+
+    for {
+        p.skip(true)
+        if p.eof() {
+            return root
+        }
+
+        if p.peek() == '[' {
+            p.next()
+            if p.peek() == '[' {
+                p.fail("arrays of tables are not supported")
+            }
+            path := p.key()
+            p.expect(']')
+            current = p.table(root, path)
+        } else {
+            p.keyValue(current)
+        }
+        p.endOfLine()
+    }
+}
+
+func ReadToml(path string) AnyMap {
+    return ParseToml(SlurpFile(path))
+}
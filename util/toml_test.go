@@ -0,0 +1,75 @@
+package util
+
+import (
+    "math"
+
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func Test_ParseToml(t *testing.T) {
+    tests := []struct {
+        name     string
+        data     string
+        expected AnyMap
+    }{
+        {"empty", "# only a comment\n", AnyMap{}},
+        {"basic string", `s = "a b" # comment`, AnyMap{"s": "a b"}},
+        {"empty strings", "a = \"\"\nb = ''", AnyMap{"a": "", "b": ""}},
+        {"escapes", `s = "q\" b\\ t\t n\n u\u00e9 U\U0001F600"`, AnyMap{"s": "q\" b\\ t\t n\n u\u00e9 U\U0001F600"}},
+        {"literal string", `s = 'C:\path\n'`, AnyMap{"s": `C:\path\n`}},
+        {"numbers", "i = 1_000\nh = 0xff\no = 0o17\nb = 0b101\nn = -3\nz = 0\nf = 1.5e3\ne = -2E-2\nf0 = 0.5", AnyMap{
+            "i": int64(1000), "h": int64(255), "o": int64(15), "b": int64(5), "n": int64(-3), "z": int64(0),
+            "f": 1500.0, "e": -0.02, "f0": 0.5,
+        }},
+        {"special floats", "a = inf\nb = +inf\nc = -inf", AnyMap{"a": math.Inf(1), "b": math.Inf(1), "c": math.Inf(-1)}},
+        {"times", "t = 07:32:00\nodt = 1979-05-27T07:32:00Z", AnyMap{"t": "07:32:00", "odt": "1979-05-27T07:32:00Z"}},
+        {"booleans", "t = true\nf = false", AnyMap{"t": true, "f": false}},
+        {"dates", "d = 2020-01-02\ndt = 2020-01-02 03:04:05", AnyMap{"d": "2020-01-02", "dt": "2020-01-02 03:04:05"}},
+        {"arrays", "a = [1, 'two', [true]]\nm = [\n  1, # one\n  2,\n]", AnyMap{
+            "a": []interface{}{int64(1), "two", []interface{}{true}},
+            "m": []interface{}{int64(1), int64(2)},
+        }},
+        {"empty array", "a = []", AnyMap{"a": []interface{}(nil)}},
+        {"inline table", `t = {a = 1, b.c = "x"}`, AnyMap{"t": AnyMap{"a": int64(1), "b": AnyMap{"c": "x"}}}},
+        {"dotted keys", "a.b = 1\na.c = 2\n\"x.y\".z = 3", AnyMap{"a": AnyMap{"b": int64(1), "c": int64(2)}, "x.y": AnyMap{"z": int64(3)}}},
+        {"tables", "top = 1\n[db]\nhost = 'h'\n[db.'x y']\nz = 2\n[other]\nk = 3", AnyMap{
+            "top": int64(1),
+            "db": AnyMap{"host": "h", "x y": AnyMap{"z": int64(2)}},
+            "other": AnyMap{"k": int64(3)},
+        }},
+    }
+    for _, tt := range tests {
+        assert.Equal(t, tt.expected, ParseToml([]byte(tt.data)), tt.name)
+    }
+    assert.True(t, math.IsNaN(ParseToml([]byte("n = -nan"))["n"].(float64)), "nan")
+}
+
+func Test_ParseTomlErrors(t *testing.T) {
+    tests := []struct {
+        name  string
+        data  string
+        error string
+    }{
+        {"multi-line basic string", "a = 1\ns = \"\"\"x\n\"\"\"", `TOML line 2: multi-line strings are not supported`},
+        {"multi-line literal string", "s = '''x\n'''", `TOML line 1: multi-line strings are not supported`},
+        {"array of tables", "[[servers]]\nname = 'a'", `TOML line 1: arrays of tables are not supported`},
+        {"unterminated string", "s = \"abc\n", `TOML line 2: unterminated string`},
+        {"invalid escape", `s = "\q"`, `TOML line 1: invalid escape \q`},
+        {"missing value", "a =\n", `TOML line 1: missing value`},
+        {"invalid value", "a = yes", `TOML line 1: invalid value yes`},
+        {"duplicate key", "a = 1\na = 2", `TOML line 2: duplicate key a`},
+        {"not a table", "a = 1\n[a]", `TOML line 2: a is not a table`},
+        {"trailing garbage", "a = 1 2", `TOML line 1: expected end of line`},
+        {"invalid key", "= 1", `TOML line 1: invalid key`},
+        {"leading zero", "a = 010", `TOML line 1: invalid value 010`},
+        {"leading zero float", "a = 01.5", `TOML line 1: invalid value 01.5`},
+        {"Infinity", "a = Infinity", `TOML line 1: invalid value Infinity`},
+        {"INF", "a = INF", `TOML line 1: invalid value INF`},
+        {"NaN", "a = NaN", `TOML line 1: invalid value NaN`},
+        {"integer overflow", "a = 99999999999999999999", `TOML line 1: invalid integer 99999999999999999999`},
+    }
+    for _, tt := range tests {
+        assert.PanicsWithValue(t, tt.error, func() { ParseToml([]byte(tt.data)) }, tt.name)
+    }
+}
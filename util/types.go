@@ -4,7 +4,10 @@ package util
 
 import (
     "fmt"
+    "reflect"
     "strconv"
+    "strings"
+    "time"
 )
 
 func ToString(i interface{}) string {
@@ -21,3 +24,133 @@ func AtoI(s string) int {
     }
     return i
 }
+
+// bool, or a string as for strconv.ParseBool ("true", "false", "1", "0"...)
+func ToBool(i interface{}) (bool, error) {
+    switch v := i.(type) {
+        case bool:
+            return v, nil
+        case string:
+            return strconv.ParseBool(strings.TrimSpace(v))
+        default:
+            return false, fmt.Errorf("%v is not a boolean", i)
+    }
+}
+
+// Anything list-like into a slice. nil gives nil, a scalar gives a one element slice.
+func ToSlice(l interface{}) []interface{} {
+    if l == nil {
+        return nil
+    }
+
+    v := reflect.ValueOf(l)
+    switch v.Kind() {
+        case reflect.Slice, reflect.Array:
+            s := make([]interface{}, v.Len())
+            for i := range s {
+                s[i] = v.Index(i).Interface()
+            }
+            return s
+        default:
+            return []interface{}{l}
+    }
+}
+
+// Anything list-like into a slice of strings, nil elements skipped.
+func ToStrings(l interface{}) []string {
+    var s []string
+    for _, e := range ToSlice(l) {
+        if e != nil {
+            s = append(s, ToString(e))
+        }
+    }
+    return s
+}
+
+// Lenient conversion to int64. Non-numbers give 0.
+func ToInt64(i interface{}) int64 {
+    switch v := i.(type) {
+        case nil:
+            return 0
+        case string:
+            if n, err := strconv.ParseInt(strings.TrimSpace(v), 0, 64); err == nil {
+                return n
+            }
+            if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+                return int64(f)
+            }
+            return 0
+        case bool:
+            if v {
+                return 1
+            }
+            return 0
+    }
+
+    v := reflect.ValueOf(i)
+    switch v.Kind() {
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            return v.Int()
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+            return int64(v.Uint())
+        case reflect.Float32, reflect.Float64:
+            return int64(v.Float())
+    }
+    return 0
+}
+
+// Lenient conversion to float64. Non-numbers give 0.
+func ToFloat64(i interface{}) float64 {
+    switch v := i.(type) {
+        case nil:
+            return 0
+        case string:
+            if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+                return f
+            }
+            return 0
+    }
+
+    v := reflect.ValueOf(i)
+    switch v.Kind() {
+        case reflect.Float32, reflect.Float64:
+            return v.Float()
+    }
+    return float64(ToInt64(i))
+}
+
+// Go template emptiness - zero values, empty strings and collections.
+func IsEmpty(i interface{}) bool {
+    if i == nil {
+        return true
+    }
+
+    v := reflect.ValueOf(i)
+    switch v.Kind() {
+        case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+            return v.Len() == 0
+        case reflect.Bool:
+            return !v.Bool()
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            return v.Int() == 0
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+            return v.Uint() == 0
+        case reflect.Float32, reflect.Float64:
+            return v.Float() == 0
+        case reflect.Ptr, reflect.Interface:
+            return v.IsNil()
+    }
+    return false
+}
+
+// Duration from "1m30s" strings, or seconds as numbers. nil gives 0.
+func ToDuration(i interface{}) time.Duration {
+    if s, ok := i.(string); ok {
+        d, err := time.ParseDuration(s)
+        if err != nil {
+            panic(err)
+        }
+        return d
+    }
+    return time.Duration(ToFloat64(i) * float64(time.Second))
+}
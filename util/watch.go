@@ -0,0 +1,64 @@
+// Utility functions. Polling for file changes.
+
+package util
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+// Modification times, sizes and modes of files and dir trees, by path
+type PathsState map[string]string
+
+// Takes the state of paths. Missing paths are left out, so they show up
+// when they appear.
+func StatPaths(paths []string) PathsState {
+    state := make(PathsState)
+    for _, p := range paths {
+        filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+            if err != nil {
+                return nil
+            }
+            state[path] = fmt.Sprintf("%d %d %s", info.ModTime().UnixNano(), info.Size(), info.Mode())
+            return nil
+        })
+    }
+    return state
+}
+
+// Paths that changed, appeared or disappeared
+func (ps PathsState) Changed(ps1 PathsState) []string {
+    var changed []string
+    for path, s := range ps1 {
+        if ps[path] != s {
+            changed = append(changed, path)
+        }
+    }
+    for path := range ps {
+        if _, exists := ps1[path]; !exists {
+            changed = append(changed, path)
+        }
+    }
+    return changed
+}
+
+// Adds the state of paths that are not in previously, ie newly watched.
+// Previously watched paths keep their state.
+func (ps PathsState) AddWatched(paths []string, previously []string) {
+    known := make(map[string]bool)
+    for _, p := range previously {
+        known[p] = true
+    }
+    var added []string
+    for _, p := range paths {
+        if !known[p] {
+            added = append(added, p)
+        }
+    }
+    for path, s := range StatPaths(added) {
+        if _, exists := ps[path]; !exists {
+            ps[path] = s
+        }
+    }
+}
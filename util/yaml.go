@@ -6,12 +6,16 @@ import (
     "gopkg.in/yaml.v3"
 )
 
-func ReadYaml(path string, target interface{}) {
-    if err := yaml.Unmarshal(SlurpFile(path), target); err != nil {
+func ParseYaml(data []byte, target interface{}) {
+    if err := yaml.Unmarshal(data, target); err != nil {
         panic(err)
     }
 }
 
+func ReadYaml(path string, target interface{}) {
+    ParseYaml(SlurpFile(path), target)
+}
+
 func WriteYaml(path string, source interface{}) {
     bytes, err := yaml.Marshal(source)
     if err != nil {
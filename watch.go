@@ -0,0 +1,113 @@
+// Watch mode - re-renders targets as config and templates are edited
+
+package gotiller
+
+import (
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/catalyst/gotiller/sources"
+    "github.com/catalyst/gotiller/util"
+)
+
+const DefaultWatchPoll = 500 * time.Millisecond
+
+// Polls the config dir and source files, re-rendering on changes.
+// If only templates changed, only their Specs are re-rendered.
+// Errors are logged, and watching goes on.
+type Watcher struct {
+    Dir           string
+    Environment   string
+    TargetBaseDir string
+    Verbose       bool
+    NoHostFuncs   bool
+    Poll          time.Duration
+
+    watched []string
+}
+
+// Template names, if all changed paths are templates.
+// Templates dir itself changes when files are replaced, ie by editors.
+// Hidden files (editor and atomic write temp files) are not templates.
+func (w *Watcher) affected(changed []string) []string {
+    templates_dir := filepath.Join(w.Dir, sources.TemplatesSubdir)
+    var names []string
+    for _, path := range changed {
+        if path == templates_dir || filepath.Dir(path) == templates_dir && strings.HasPrefix(filepath.Base(path), ".") {
+            continue
+        }
+        if filepath.Dir(path) != templates_dir {
+            return nil
+        }
+        names = append(names, filepath.Base(path))
+    }
+    return names
+}
+
+// Renders named Specs, all if names is nil
+func (w *Watcher) render(names []string) {
+    defer func() {
+        if r := recover(); r != nil {
+            logger.Printf("Error: %v\n", r)
+        }
+    }()
+
+    processor := sources.LoadConfigsFromDir(w.Dir)
+    processor.NoHostFunctions = w.NoHostFuncs
+    w.watched = append([]string{w.Dir}, processor.WatchedPaths()...)
+
+    environment := resolveEnvironment(processor, w.Environment)
+    if names == nil {
+        logger.Printf("Rendering %s\n", environment)
+    } else {
+        logger.Printf("Rendering %v for %s\n", names, environment)
+    }
+    result := processor.RunSpecsForEnvironment(environment, w.TargetBaseDir, names)
+    logger.Printf("Done, %d changed\n", len(result.ChangedTargets()))
+}
+
+// Renders named Specs, all if names is nil. Returns the state of watched
+// paths taken before rendering, so changes made meanwhile are picked up
+// by the next poll.
+func (w *Watcher) renderFrom(state util.PathsState, names []string) util.PathsState {
+    watched := w.watched
+    w.render(names)
+    state.AddWatched(w.watched, watched)
+    return state
+}
+
+// Renders, then watches until stop is closed (forever if nil)
+func (w *Watcher) Run(stop <-chan struct{}) {
+    if w.TargetBaseDir == "" {
+        logger.Panic("Watch needs output base dir")
+    }
+    if w.Verbose {
+        logger.SetDebug(true)
+    }
+    if w.Poll == 0 {
+        w.Poll = DefaultWatchPoll
+    }
+    w.watched = []string{w.Dir}
+
+    state := w.renderFrom(util.StatPaths(w.watched), nil)
+    logger.Printf("Watching %v\n", w.watched)
+
+    ticker := time.NewTicker(w.Poll)
+    defer ticker.Stop()
+    for {
+        select {
+            case <-stop:
+                return
+            case <-ticker.C:
+                new_state := util.StatPaths(w.watched)
+                changed := state.Changed(new_state)
+                if len(changed) == 0 {
+                    break
+                }
+                logger.Printf("Changed %v\n", changed)
+
+                state = w.renderFrom(new_state, w.affected(changed))
+        }
+    }
+}